@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// jsonActionsPrompt is appended to the system prompt when json_actions is set.
+const jsonActionsPrompt = `
+
+Instead of the format above, respond with only a JSON array of actions, with no other text.
+Each action is an object with a "type" of "text", "key", or "mouse":
+- {"type": "text", "text": "cd ~"} types text.
+- {"type": "key", "key": "t", "modifiers": ["command"]} presses a key, optionally with modifiers
+  ("command", "shift", "alt", "ctrl"). Key names include letters, digits, "enter", "tab", "escape",
+  "space", "backspace", "up", "down", "left", and "right". Add "pause_ms" to wait afterwards.
+- {"type": "mouse", "mouse": "click"} clicks the mouse. "mouse" may be "click", "right-click",
+  "double-click", "move" (to "x" and "y"), "scroll-up", or "scroll-down".`
+
+// action is a single step of a JSON actions response.
+type action struct {
+	Type      string   `json:"type"` // "text", "key", or "mouse"
+	Text      string   `json:"text,omitempty"`
+	Key       string   `json:"key,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	PauseMs   int      `json:"pause_ms,omitempty"`
+	Mouse     string   `json:"mouse,omitempty"`
+	X         int      `json:"x,omitempty"`
+	Y         int      `json:"y,omitempty"`
+}
+
+// parseActions parses a JSON actions response.
+func parseActions(text string) ([]action, error) {
+	var actions []action
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &actions); err != nil {
+		return nil, err
+	}
+	for _, a := range actions {
+		switch a.Type {
+		case "text", "key", "mouse":
+		default:
+			return nil, fmt.Errorf("unknown action type %q", a.Type)
+		}
+	}
+	return actions, nil
+}
+
+// chordsToActions converts text in the {...} chord format to JSON actions,
+// so few-shot examples can be shown to the model in JSON actions mode.
+// It splits text the same way simulateTyping does.
+func chordsToActions(text string) string {
+	text = escapeBraces(text)
+	var actions []action
+	lastIndex := 0
+	for _, match := range keyTapPattern.FindAllStringSubmatchIndex(text, -1) {
+		if lastIndex < match[0] {
+			actions = append(actions, action{Type: "text", Text: unescapeBraces(text[lastIndex:match[0]])})
+		}
+		lastIndex = chordEnd(text, match[1])
+
+		modifiers, key := extractModifiersAndKeyFromMatch(text, match)
+		a := action{Type: "key", Key: key, Modifiers: modifiers}
+		if match[6] != -1 {
+			a.PauseMs, _ = strconv.Atoi(text[match[6]:match[7]])
+		}
+		actions = append(actions, a)
+	}
+	if lastIndex < len(text) {
+		actions = append(actions, action{Type: "text", Text: unescapeBraces(text[lastIndex:])})
+	}
+	b, _ := json.Marshal(actions)
+	return string(b)
+}
+
+// runActions performs actions in order with exec, stopping between actions once
+// ctx is cancelled. Mouse actions always use robotgo.
+func runActions(ctx context.Context, exec Executor, actions []action) error {
+	typed := 0
+	for _, a := range actions {
+		if err := ctx.Err(); err != nil {
+			return &typingCancelledError{err: err, typed: typed}
+		}
+		switch a.Type {
+		case "text":
+			if err := exec.Type(a.Text); err != nil {
+				return err
+			}
+			typed++
+		case "key":
+			if err := exec.KeyTap(a.Key, a.Modifiers...); err != nil {
+				return err
+			}
+		case "mouse":
+			runMouseAction(a)
+		}
+		if a.PauseMs > 0 {
+			select {
+			case <-time.After(time.Duration(a.PauseMs) * time.Millisecond):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return nil
+}
+
+// runMouseAction performs a mouse action.
+func runMouseAction(a action) {
+	switch a.Mouse {
+	case "click":
+		robotgo.Click("left")
+	case "right-click":
+		robotgo.Click("right")
+	case "double-click":
+		robotgo.Click("left", true)
+	case "move":
+		robotgo.Move(a.X, a.Y)
+	case "scroll-up":
+		robotgo.ScrollDir(5, "up")
+	case "scroll-down":
+		robotgo.ScrollDir(5, "down")
+	default:
+		log.Printf("Unknown mouse action: %q", a.Mouse)
+	}
+}
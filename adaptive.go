@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// slowSamples is the number of recent transcriptions averaged to decide
+	// whether transcription is slow.
+	slowSamples = 3
+	// fallbackPeriod is how long fallback_whisper_model is used before the
+	// configured model is tried again.
+	fallbackPeriod = time.Minute
+)
+
+// latencyTracker switches transcription to fallback_whisper_model while
+// transcription with the configured model is slow. It is only used by
+// processUtterances.
+type latencyTracker struct {
+	recent        []time.Duration // the latest transcription times with the configured model
+	fallbackUntil time.Time       // when to try the configured model again; zero unless falling back
+}
+
+// slowTranscription returns the average transcription time above which
+// fallback_whisper_model is used.
+func (c *RightHandConfig) slowTranscription() time.Duration {
+	if c.SlowTranscriptionMs <= 0 {
+		return DefaultSlowTranscription
+	}
+	return time.Duration(c.SlowTranscriptionMs) * time.Millisecond
+}
+
+// model returns fallback_whisper_model while falling back, and "" to use
+// the configured model.
+func (t *latencyTracker) model(cfg *RightHandConfig) string {
+	if cfg.FallbackWhisperModel == "" || t.fallbackUntil.IsZero() {
+		return ""
+	}
+	if time.Now().Before(t.fallbackUntil) {
+		return cfg.FallbackWhisperModel
+	}
+	t.fallbackUntil = time.Time{}
+	fmt.Printf("🐇 Trying whisper model %q again\n", cfg.WhisperModel)
+	log.Printf("Fallback period over, transcribing with the configured whisper model again")
+	return ""
+}
+
+// record notes that a transcription with the configured model took elapsed,
+// and starts falling back if recent transcriptions were slow on average.
+func (t *latencyTracker) record(cfg *RightHandConfig, elapsed time.Duration) {
+	if cfg.FallbackWhisperModel == "" {
+		return
+	}
+	t.recent = append(t.recent, elapsed)
+	if len(t.recent) > slowSamples {
+		t.recent = t.recent[1:]
+	}
+	var total time.Duration
+	for _, d := range t.recent {
+		total += d
+	}
+	average := total / time.Duration(len(t.recent))
+	if len(t.recent) < slowSamples || average <= cfg.slowTranscription() {
+		return
+	}
+	t.recent = nil
+	t.fallbackUntil = time.Now().Add(fallbackPeriod)
+	fmt.Printf("🐢 Transcription is slow (%v on average), switching to whisper model %q for %v\n", average.Round(time.Millisecond), cfg.FallbackWhisperModel, fallbackPeriod)
+	log.Printf("Transcriptions took %v on average, over %v; falling back to %q", average, cfg.slowTranscription(), cfg.FallbackWhisperModel)
+}
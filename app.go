@@ -2,21 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	"github.com/go-vgo/robotgo"
 	"github.com/progrium/macdriver/cocoa"
 	"github.com/progrium/macdriver/objc"
-	"github.com/tmc/audioutil/wavutil"
-	"github.com/tmc/audioutil/whisperaudio"
-	"github.com/tmc/audioutil/whisperutil"
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/schema"
 	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
 )
@@ -24,6 +25,12 @@ import (
 const (
 	// NSEventModifierFlagCommand is the command key modifier flag.
 	NSEventModifierFlagCommand = 1 << 20
+	// NSEventModifierFlagOption is the option key modifier flag.
+	NSEventModifierFlagOption = 1 << 19
+	// NSEventModifierFlagControl is the control key modifier flag.
+	NSEventModifierFlagControl = 1 << 18
+	// NSEventModifierFlagShift is the shift key modifier flag.
+	NSEventModifierFlagShift = 1 << 17
 	// VKControl is the virtual key code for the control key.
 	VKControl = 0x3B
 	// VKCommand is the virtual key code for the command key.
@@ -34,21 +41,65 @@ const (
 
 // App is the main application.
 type App struct {
-	listeningToggle chan struct{}
-	wa              *whisperaudio.WhisperAudio
-	llm             llms.ChatLLM
-	cfg             *RightHandConfig
+	listeningToggle chan string // the intent to listen for, if any, when starting
+	llm             chatModel
+	cfg             atomic.Pointer[RightHandConfig] // swapped as a whole on reload
+
+	mu             sync.Mutex
+	cancelInFlight context.CancelFunc         // cancels the command currently being handled
+	commands       map[int]context.CancelFunc // cancels each command still being handled, by ID
+	nextCommand    int
+	llms           map[string]chatModel // models picked per command with a spoken prefix
+
+	disabled  atomic.Bool // when set, activation chords are ignored
+	listening atomic.Bool // mirrors the listening state of runMainLoop
+	lastPress time.Time   // time of the last unmatched activation chord, used only by handleEvents
+
+	input atomic.Pointer[audioInput] // the microphone, reopened by switchInputDevice
+
+	segments *segmentTranscriber // the configured whisper model, used only by processUtterances
+
+	retry        chan struct{}                  // asks runMainLoop to queue the last utterance again for retry_hotkey
+	halt         chan struct{}                  // asks runMainLoop to stop listening and drop the utterances not yet handled
+	latency      latencyTracker                 // for fallback_whisper_model, used only by processUtterances
+	transcribers map[string]*segmentTranscriber // by whisper model, for retry_whisper_model, fallback_whisper_model, and intents; loaded on first use by processUtterances
+
+	relisten      chan string  // asks runMainLoop to listen again for the given intent, for empty_retry_listen_ms
+	emptyAttempts atomic.Int32 // utterances in a row in which nothing was transcribed
+
+	sessions atomic.Int64 // listening sessions started, for supersede_in_flight
+
+	lastCommand atomic.Pointer[commandLogEntry] // the last command interpreted by the language model, for confirm_hotkey
+
+	typing   *typingQueue // serializes typing across commands
+	executor Executor     // if set, performs input in place of the configured executor, as in tests
+
+	cooldownUntil atomic.Int64 // unix nanoseconds until which activation is ignored after a command
+	previousApp   atomic.Int32 // process ID of the last frontmost app other than RightHand, for refocus_app
+	limiter       tokenBucket  // for max_commands_per_minute
+
+	status *statusPanel // nil unless running with -tui
+	review reviewWindow // for output_target: review, only touched on the main thread
+	menu   *menuBar     // nil unless menu_bar is set
+
+	language atomic.Value // string language of the last utterance, detected with language: auto
 }
 
 // newApp creates a new app.
 func newApp(cfg RightHandConfig) (*App, error) {
-	fmt.Println("\nRightHand - Voice Control Assistant")
-	fmt.Println("===================================")
+	if !cfg.quiet() {
+		fmt.Println("\nRightHand - Voice Control Assistant")
+		fmt.Println("===================================")
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
 
 	// Create a log file
 	logFile, err := os.OpenFile("righthand.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("could not create log file: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrLogFile, err)
 	}
 
 	// Create a custom writer that filters out whisper messages
@@ -67,40 +118,153 @@ func newApp(cfg RightHandConfig) (*App, error) {
 	// Set up logging to filter messages but keep stderr as is
 	log.SetOutput(filterWriter)
 
+	for _, warning := range cfg.duplicatePrograms() {
+		fmt.Printf("⚠️  Config: %s\n", warning)
+		log.Printf("Config: %s", warning)
+	}
+
+	var (
+		input    *audioInput
+		segments *segmentTranscriber
+	)
+	if !cfg.NoAudio {
+		// without a microphone, every listening session would silently capture nothing
+		if _, ok := defaultInputDevice(); !ok {
+			return nil, ErrNoInputDevice
+		}
+		input, segments, err = newVoiceInput(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrWhisperInit, err)
+		}
+	}
+
+	fmt.Println("Initializing language model...")
+	cllm, err := newLLM(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLLMInit, err)
+	}
+	if cfg.PreloadLLM {
+		go preloadLLM(cfg)
+	}
+
+	if !cfg.quiet() {
+		fmt.Println("Initialization complete!\n")
+	}
+
+	app := &App{
+		listeningToggle: make(chan string, 1),
+		relisten:        make(chan string, 1),
+		retry:           make(chan struct{}, 1),
+		halt:            make(chan struct{}, 1),
+		segments:        segments,
+		llm:             cllm,
+		typing:          newTypingQueue(),
+	}
+	if input != nil {
+		app.input.Store(input)
+	}
+	app.setConfig(&cfg)
+	app.disabled.Store(cfg.Disabled)
+	return app, nil
+}
+
+// newVoiceInput initializes voice recognition. It returns the audio input and
+// a transcriber for the whisper model in use, which may differ from the
+// configured one if it could not be downloaded.
+func newVoiceInput(cfg RightHandConfig) (*audioInput, *segmentTranscriber, error) {
 	// Temporarily disable stderr during initialization
 	oldStderr := os.Stderr
 	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
 	os.Stderr = devNull
+	// Restore stderr
+	defer func() { os.Stderr = oldStderr }()
 
 	fmt.Println("Initializing voice recognition...")
+	printWhisperAcceleration(cfg)
 
 	// Initialize whisper
-	wa, err := whisperaudio.New(
-		whisperutil.WithAutoFetch(),
-		whisperutil.WithModelName(cfg.WhisperModel),
-	)
+	path, err := fetchWhisperModel(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := startSpinner(fmt.Sprintf("Loading whisper model %s", filepath.Base(path)))
+	t, err := newSegmentTranscriber(path)
+	stop()
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := openAudioInput()
+	if err != nil {
+		t.close()
+		return nil, nil, err
+	}
 
-	// Restore stderr
-	os.Stderr = oldStderr
+	// Prime the model so the first real command isn't slowed by lazy initialization
+	if cfg.Warmup {
+		stop := startSpinner("Warming up voice recognition")
+		if _, _, err := t.transcribe(make([]float32, whisper.SampleRate/2), "", nil); err != nil {
+			log.Printf("Error warming up voice recognition: %v", err)
+		}
+		stop()
+	}
+	return input, t, nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("could not initialize voice recognition: %w", err)
+// whisperGPUSupported reports whether the linked whisper.cpp binding can offload
+// transcription to the GPU. The binding does not yet expose GPU context
+// parameters, so transcription always runs on the CPU.
+const whisperGPUSupported = false
+
+// printWhisperAcceleration prints whether transcription is GPU accelerated.
+func printWhisperAcceleration(cfg RightHandConfig) {
+	switch {
+	case cfg.WhisperGPU && whisperGPUSupported:
+		fmt.Println("Voice recognition acceleration: GPU (Metal)")
+	case cfg.WhisperGPU:
+		fmt.Println("Voice recognition acceleration: CPU (GPU requested but not supported by this build)")
+	default:
+		fmt.Println("Voice recognition acceleration: CPU")
 	}
+}
 
-	fmt.Println("Initializing language model...")
-	cllm, err := openai.NewChat(openai.WithModel(cfg.LLMModel))
+// config returns the current configuration.
+// The returned value must not be modified; use setConfig to replace it.
+func (app *App) config() *RightHandConfig {
+	return app.cfg.Load()
+}
+
+// setConfig replaces the current configuration, including its key_map and
+// chord_separators.
+func (app *App) setConfig(cfg *RightHandConfig) {
+	setKeyMap(cfg.KeyMap)
+	setChordSeparators(cfg.ChordSeparators)
+	app.cfg.Store(cfg)
+}
+
+// reloadConfig reloads the configuration file, keeping settings that come from flags.
+func (app *App) reloadConfig() error {
+	cfg, err := loadConfig()
 	if err != nil {
-		return nil, fmt.Errorf("could not initialize language model: %w", err)
+		return err
 	}
+	cfg.DumpWAVFile = app.config().DumpWAVFile
+	cfg.NoAudio = app.config().NoAudio
+	cfg.Verbose = app.config().Verbose
+	cfg.PrintPrompt = app.config().PrintPrompt
+	cfg.TUI = app.config().TUI
+	cfg.Explain = app.config().Explain
+	cfg.Training = app.config().Training
+	cfg.QuietFlag = app.config().QuietFlag
+	app.setConfig(&cfg)
+	return nil
+}
 
-	fmt.Println("Initialization complete!\n")
-
-	return &App{
-		listeningToggle: make(chan struct{}, 1),
-		wa:              wa,
-		llm:             cllm,
-		cfg:             &cfg,
-	}, nil
+// verbosef prints a diagnostic message when running with -verbose. Messages are always logged.
+func (app *App) verbosef(format string, args ...any) {
+	log.Printf(format, args...)
+	if app.config().Verbose {
+		fmt.Printf("🔍 "+format+"\n", args...)
+	}
 }
 
 // filterWriter is a custom writer that can filter out unwanted log messages
@@ -121,90 +285,393 @@ func (w *filterWriter) Write(p []byte) (n int, err error) {
 func (app *App) run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	if app.config().TUI {
+		// the panel replaces status output, which is discarded
+		out := os.Stdout
+		devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		os.Stdout = devNull
+		app.status = newStatusPanel(out, app.config().hotkeyHelp())
+		app.showIdle()
+	}
+	if app.config().MenuBar {
+		app.menu = &menuBar{}
+	}
 	go app.runMainLoop(ctx)
 
+	if app.config().quiet() {
+		if app.disabled.Load() {
+			fmt.Printf("💤 RightHand is disabled. Press %s to enable.\n", app.config().toggleHotkeyName())
+		}
+		fmt.Println("Ready")
+		app.runNSApp(ctx)
+		return nil
+	}
 	fmt.Println("\nInstructions:")
 	fmt.Println("1. Press Command + Control to start listening")
 	fmt.Println("2. Speak your command")
 	fmt.Println("3. Release the keys to execute")
+	fmt.Printf("4. Press %s to cancel a command in progress\n", app.config().cancelHotkeyName())
+	fmt.Printf("5. Press %s to disable or enable RightHand\n", app.config().toggleHotkeyName())
 	fmt.Println("\nExample commands:")
 	fmt.Println("- \"open a new tab\"")
 	fmt.Println("- \"go to my home directory\"")
 	fmt.Println("- \"scroll down\"")
+	if app.disabled.Load() {
+		fmt.Printf("\n💤 RightHand is disabled. Press %s to enable.\n", app.config().toggleHotkeyName())
+	}
 	fmt.Println("\nReady for commands! Press Command + Control to begin...\n")
 
 	app.runNSApp(ctx)
 	return nil
 }
 
-// runMainLoop runs the main loop.
+// runMainLoop runs the main loop. It records utterances and queues them for
+// processUtterances, so it is always ready to start listening again.
 func (app *App) runMainLoop(ctx context.Context) {
 	var (
 		listening        bool
 		listeningTimeout <-chan time.Time
-		audioBuffer      []float32
+		current          *utterance // nil unless listening
+		capture          *audioCapture
+		chunks           <-chan []float32 // nil unless capturing
+		meter            = &levelMeter{status: app.status}
+
+		// set when the next session is started by empty_retries, to listen
+		// for empty_retry_listen_ms instead of the usual timeout
+		relistening bool
+
+		// with pre_roll_ms set, the stream keeps running between sessions
+		// and the latest audio is kept in preRoll, to start the next utterance
+		streaming  bool
+		background *audioCapture // collects audio for preRoll while not listening
+		preRoll    []float32
+
+		// with coalesce_window set, a finished utterance is held in pending
+		// until no new session starts within the window after it stopped
+		lastStop     time.Time
+		pending      *utterance
+		pendingFlush <-chan time.Time
+
+		// finished utterances waiting for processUtterances, oldest first
+		queue      []*utterance
+		utterances = make(chan *utterance)
+		last       *utterance // the most recently queued, for retry_hotkey
 	)
+	go app.processUtterances(ctx, utterances)
+
+	enqueue := func(u *utterance) {
+		queue = append(queue, u)
+		last = u
+		app.verbosef("Queued utterance, %d waiting to be processed", len(queue))
+	}
+
+	if err := watchInputDevice(); err != nil {
+		log.Printf("Error watching input device: %v", err)
+	}
+
+	startPreRoll := func() {
+		if !streaming {
+			if err := app.input.Load().start(); err != nil {
+				log.Printf("Error starting audio: %v", err)
+				return
+			}
+			streaming = true
+		}
+		background = startAudioCapture(ctx, app.input.Load())
+		chunks = background.chunks
+	}
+	if app.config().PreRollMs > 0 {
+		startPreRoll()
+	}
 
 	for {
+		// send the oldest queued utterance once the worker is ready
+		var (
+			out  chan<- *utterance
+			next *utterance
+		)
+		if len(queue) > 0 {
+			out, next = utterances, queue[0]
+		}
+
 		select {
-		case <-app.listeningToggle:
+		case intent := <-app.listeningToggle:
 			listening = !listening
+			app.listening.Store(listening)
 			if listening {
 				listeningTimeout = time.After(DefaultTimeout)
+				if relistening {
+					listeningTimeout = time.After(time.Duration(app.config().EmptyRetryListenMs) * time.Millisecond)
+					relistening = false
+				}
+				// the chunk being collected holds the start of what is said,
+				// so stopping waits for it (up to a second)
+				var start []float32
+				if background != nil {
+					start = preRoll
+					for _, buf := range background.stop() {
+						start = append(start, buf...)
+					}
+					background, chunks, preRoll = nil, nil, nil
+				}
+				if inputDeviceChanged() {
+					if streaming {
+						if err := app.input.Load().stop(); err != nil {
+							log.Printf("Error stopping audio: %v", err)
+						}
+						streaming = false
+					}
+					start = nil
+					app.switchInputDevice()
+				}
+				if pending != nil && time.Since(lastStop) <= app.config().CoalesceWindow {
+					fmt.Println("➕ Continuing previous command...")
+					current, pending, pendingFlush = pending, nil, nil
+				} else {
+					if pending != nil {
+						enqueue(pending)
+						pending, pendingFlush = nil, nil
+					}
+					current = app.newUtterance(intent)
+				}
+				current.sessions++
+				current.session = app.sessions.Add(1)
+				if app.config().SupersedeInFlight {
+					for _, u := range queue {
+						u.discard()
+					}
+					if len(queue) > 0 {
+						fmt.Printf("⏭️  Dropping %d waiting commands\n", len(queue))
+						queue = nil
+					}
+					app.supersedeCommands()
+				}
+				current.add(start)
 				fmt.Println("🎤 Listening...")
-				audioBuffer = nil
-				err := app.wa.Start()
-				if err != nil {
-					log.Printf("Error starting audio: %v", err)
+				app.setState("Listening")
+				if !streaming {
+					err := app.input.Load().start()
+					if err != nil {
+						log.Printf("Error starting audio: %v", err)
+					}
+					streaming = true
 				}
+				capture = startAudioCapture(ctx, app.input.Load())
+				chunks = capture.chunks
 			} else {
-				fmt.Println("Processing...")
-				if err := app.wa.Stop(); err != nil {
-					log.Printf("Error stopping audio: %v", err)
+				meter.clear()
+				for _, buf := range capture.stop() {
+					current.add(buf)
 				}
-				if app.cfg.DumpWAVFile {
-					go wavutil.SaveWAV("output.wav", audioBuffer[:], whisper.SampleRate)
+				app.verbosef("Captured %d samples, dropped %d chunks", len(current.audio), capture.dropped.Load())
+				if app.config().LogAudioStats {
+					log.Printf("Audio stats: %s", audioStats(current.audio))
 				}
-				text, err := app.wa.Transcribe(audioBuffer)
-				if err != nil {
-					log.Printf("Error transcribing: %v", err)
-					continue
+				capture, chunks = nil, nil
+				if app.config().PreRollMs > 0 {
+					startPreRoll()
+				} else {
+					if err := app.input.Load().stop(); err != nil {
+						log.Printf("Error stopping audio: %v", err)
+					}
+					streaming = false
 				}
-				if text != "" {
-					fmt.Printf("💬 You said: %q\n", text)
-					go app.handleText(ctx, text)
+				if cfg := app.config(); cfg.DumpWAVFile {
+					// a copy, since the utterance may be transcribed meanwhile and pcm24 scales the samples in place
+					go func(samples []float32, format string) {
+						if err := saveWAV("output.wav", samples, format); err != nil {
+							log.Printf("Error saving output.wav: %v", err)
+						}
+					}(slices.Clone(current.audio), cfg.DumpWAVFormat)
 				}
+				lastStop = time.Now()
+				if window := app.config().CoalesceWindow; window > 0 {
+					pending, pendingFlush = current, time.After(window)
+				} else {
+					enqueue(current)
+				}
+				current = nil
+				app.showIdle()
 			}
-		case <-listeningTimeout:
+		case intent := <-app.relisten:
 			if listening {
-				app.listeningToggle <- struct{}{}
+				continue
 			}
-		case <-ctx.Done():
-			fmt.Println("done")
-			return
-		default:
-			if !listening {
+			select {
+			case app.listeningToggle <- intent:
+				relistening = true
+			default: // the activation chord was pressed meanwhile
+			}
+		case <-app.retry:
+			if last == nil {
+				fmt.Println("🤷 Nothing to retry yet")
 				continue
 			}
-			buf, err := app.wa.CollectAudioData(time.Second)
-			if err != nil {
-				log.Printf("error collecting audio data: %v", err)
+			fmt.Printf("🔁 Retrying the last command with whisper model %q...\n", app.config().RetryWhisperModel)
+			enqueue(&utterance{audio: last.audio, activeApp: last.activeApp, bundleID: last.bundleID, intent: last.intent, retry: true, session: app.sessions.Load()})
+		case <-pendingFlush:
+			enqueue(pending)
+			pending, pendingFlush = nil, nil
+		case <-app.halt:
+			dropped := len(queue)
+			if pending != nil {
+				dropped++
+			}
+			for _, u := range append(queue, current, pending) {
+				u.discard()
+			}
+			queue, pending, pendingFlush = nil, nil, nil
+			if listening {
+				listening = false
+				app.listening.Store(false)
+				meter.clear()
+				capture.stop()
+				capture, chunks, current = nil, nil, nil
+				if app.config().PreRollMs > 0 {
+					startPreRoll()
+				} else {
+					if err := app.input.Load().stop(); err != nil {
+						log.Printf("Error stopping audio: %v", err)
+					}
+					streaming = false
+				}
+				fmt.Println("🔇 Stopped listening")
+			}
+			if dropped > 0 {
+				fmt.Printf("🗑️  Dropped %d commands waiting to be handled\n", dropped)
+			}
+		case out <- next:
+			queue = queue[1:]
+		case buf := <-chunks:
+			if current == nil {
+				// keep only the last pre_roll_ms of audio
+				preRoll = append(preRoll, buf...)
+				if n := app.config().PreRollMs * whisper.SampleRate / 1000; len(preRoll) > n {
+					preRoll = preRoll[len(preRoll)-n:]
+				}
 				continue
 			}
-			audioBuffer = append(audioBuffer, buf...)
+			current.add(buf)
+			meter.update(buf)
+		case <-listeningTimeout:
+			if listening {
+				app.listeningToggle <- ""
+			}
+		case <-ctx.Done():
+			// nothing was lost, so there is nothing to recover
+			for _, u := range append(queue, current, pending) {
+				u.discard()
+			}
+			fmt.Println("done")
+			return
+		}
+	}
+}
 
+// processUtterances transcribes and handles utterances one at a time, in the
+// order they were received.
+func (app *App) processUtterances(ctx context.Context, utterances <-chan *utterance) {
+	for {
+		select {
+		case u := <-utterances:
+			app.processUtterance(ctx, u)
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
+// processUtterance transcribes and handles an utterance.
+func (app *App) processUtterance(ctx context.Context, u *utterance) {
+	if app.disabled.Load() {
+		u.discard()
+		return
+	}
+	fmt.Println("Processing...")
+	app.setState("Processing")
+	// the app that was frontmost when listening started, or else the current one
+	activeApp, bundleID := u.activeApp, u.bundleID
+	if activeApp == "" {
+		activeApp, bundleID = frontmostApp()
+	}
+	cfg := app.config()
+	model := cfg.intentWhisperModel(u.intent)
+	if u.retry {
+		model = cfg.RetryWhisperModel
+	} else if model == "" {
+		model = app.latency.model(cfg)
+	}
+	start := time.Now()
+	text, err := app.transcribe(u.audio, model)
+	if model == "" && err == nil {
+		app.latency.record(cfg, time.Since(start))
+	}
+	if err != nil {
+		log.Printf("Error transcribing: %v", err)
+		app.status.addError()
+	}
+	// the utterance was transcribed, so there is nothing left to recover
+	u.discard()
+	if cfg.SupersedeInFlight && u.session < app.sessions.Load() {
+		fmt.Println("⏭️  Skipping a command superseded by a newer one")
+		app.showIdle()
+		return
+	}
+	if text == "" {
+		app.showIdle()
+		app.retryEmpty(u)
+		return
+	}
+	app.emptyAttempts.Store(0)
+	if u.sessions > 1 {
+		fmt.Printf("💬 You said (combined from %d recordings): %q\n", u.sessions, text)
+	} else {
+		fmt.Printf("💬 You said: %q\n", text)
+	}
+	app.status.setTranscription(text)
+	output := app.handleTextFor(ctx, text, activeApp, bundleID, u.intent)
+	if app.config().Training {
+		app.recordTraining(u, text, output, activeApp, bundleID)
+	}
+}
+
+// switchInputDevice reopens the audio input on the current default input
+// device, keeping the whisper model loaded. The input must be stopped.
+func (app *App) switchInputDevice() {
+	dev, ok := defaultInputDevice()
+	if !ok {
+		fmt.Println("⚠️  No audio input device available")
+		log.Printf("Default input device removed")
+		return
+	}
+	fmt.Printf("🎙️  Input device changed to %q, reopening audio input...\n", dev.Name)
+	log.Printf("Default input device changed to %q (id %d)", dev.Name, dev.ID)
+	if err := app.input.Load().close(); err != nil {
+		log.Printf("Error closing audio input: %v", err)
+	}
+	input, err := openAudioInput()
+	if err != nil {
+		log.Printf("Error reopening audio input: %v", err)
+		return
+	}
+	app.input.Store(input)
+}
+
 // runNSApp runs the NSApp.
 func (app *App) runNSApp(ctx context.Context) {
 	nsApp := cocoa.NSApp_WithDidLaunch(func(n objc.Object) {
+		app.menu.install(app)
 		events := make(chan cocoa.NSEvent, 64)
 		go app.handleEvents(events)
 		cocoa.NSEvent_GlobalMonitorMatchingMask(cocoa.NSEventMaskAny, events)
 	})
-	nsApp.ActivateIgnoringOtherApps(true)
+	if app.menu != nil {
+		// run as a menu bar agent, without a Dock icon
+		nsApp.SetActivationPolicy(cocoa.NSApplicationActivationPolicyAccessory)
+	} else if !app.config().NoActivate {
+		app.rememberFrontmost() // before RightHand takes focus
+		nsApp.ActivateIgnoringOtherApps(true)
+	}
 	nsApp.Run()
 }
 
@@ -213,6 +680,43 @@ func (app *App) handleEvents(events chan cocoa.NSEvent) {
 	for {
 		e := <-events
 		typ := e.Get("type").Int()
+		// the emergency stop takes priority over everything else
+		if typ == cocoa.NSEventTypeKeyDown && app.config().emergencyStop().matches(e) {
+			app.emergencyStop()
+			continue
+		}
+		if typ == cocoa.NSEventTypeKeyDown && app.config().toggleHotkey().matches(e) {
+			app.toggleEnabled()
+			continue
+		}
+		if typ == cocoa.NSEventTypeKeyDown && app.config().cancelHotkey().matches(e) && !app.disabled.Load() {
+			app.cancelCommand()
+			continue
+		}
+		if h, ok := app.config().retryHotkey(); ok && typ == cocoa.NSEventTypeKeyDown && h.matches(e) && !app.disabled.Load() {
+			select {
+			case app.retry <- struct{}{}:
+			default: // a retry is already requested
+			}
+			continue
+		}
+		if h, ok := app.config().confirmHotkey(); ok && typ == cocoa.NSEventTypeKeyDown && h.matches(e) && !app.disabled.Load() {
+			app.confirmLastCommand()
+			continue
+		}
+		if typ == cocoa.NSEventTypeKeyDown && !app.disabled.Load() && slices.Contains(app.config().ActivationKeyCodes, int(e.Get("keyCode").Int())) {
+			// holding the key down repeats it; only the first press counts
+			if !e.Get("isARepeat").Bool() && app.acceptActivation() {
+				app.activate("")
+			}
+			continue
+		}
+		if typ == cocoa.NSEventTypeKeyDown && !app.disabled.Load() {
+			if intent, ok := app.config().intentHotkey(e); ok {
+				app.activate(intent)
+			}
+			continue
+		}
 		if typ != cocoa.NSEventTypeFlagsChanged {
 			continue
 		}
@@ -226,11 +730,223 @@ func (app *App) manageListeningState(e cocoa.NSEvent) {
 	modifierFlags := e.Get("modifierFlags").Int()
 	cmdDown := modifierFlags&NSEventModifierFlagCommand != 0
 	keyUp := !(modifierFlags&0x1 != 0)
-	if (keyCode == VKControl) && cmdDown && keyUp {
-		app.listeningToggle <- struct{}{}
+	if app.disabled.Load() {
+		return
+	}
+	if (keyCode == VKControl) && cmdDown && keyUp && app.acceptActivation() {
+		app.activate("")
 	}
 }
 
+// activate starts listening for the given intent, or "" for the active app's
+// examples, unless activation is currently not allowed. If RightHand is
+// already listening, it stops.
+func (app *App) activate(intent string) {
+	if !app.listening.Load() {
+		if until := app.cooldownUntil.Load(); time.Now().UnixNano() < until {
+			fmt.Printf("⏸️  Ignoring activation during cooldown (%v left)\n", time.Until(time.Unix(0, until)).Round(time.Millisecond))
+			return
+		}
+		app.rememberFrontmost()
+		name, bundleID := frontmostApp()
+		if !app.config().appEnabled(name, bundleID) {
+			fmt.Printf("🚫 RightHand is not enabled for %s\n", appName(name))
+			return
+		}
+		if intent != "" {
+			fmt.Printf("🎯 Intent: %s\n", intent)
+		}
+	}
+	app.listeningToggle <- intent
+}
+
+// startCooldown ignores activation for the configured cooldown after a command.
+func (app *App) startCooldown(cfg *RightHandConfig) {
+	if cfg.CooldownMs > 0 {
+		app.cooldownUntil.Store(time.Now().Add(time.Duration(cfg.CooldownMs) * time.Millisecond).UnixNano())
+	}
+}
+
+// frontmostApp returns the name and bundle identifier of the frontmost
+// application, or empty strings if there is none.
+func frontmostApp() (name, bundleID string) {
+	frontmost := cocoa.NSWorkspace_SharedWorkspace().FrontmostApplication()
+	if frontmost.Pointer() == 0 {
+		return "", ""
+	}
+	return fmt.Sprint(frontmost.LocalizedName()), frontmost.Get("bundleIdentifier").String()
+}
+
+// appName returns name for display, or "Unknown" if there was no frontmost
+// application.
+func appName(name string) string {
+	if name == "" {
+		return "Unknown"
+	}
+	return name
+}
+
+// acceptActivation reports whether an activation chord should toggle listening.
+// With double_press set, starting to listen takes two chords within
+// double_press_interval; stopping always takes one.
+func (app *App) acceptActivation() bool {
+	cfg := app.config()
+	if !cfg.DoublePress || app.listening.Load() {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(app.lastPress) <= cfg.doublePressInterval() {
+		app.lastPress = time.Time{}
+		return true
+	}
+	app.lastPress = now
+	return false
+}
+
+// toggleHotkeyName returns the hotkey that disables or enables RightHand, as
+// written in toggle_hotkey, for display.
+func (c RightHandConfig) toggleHotkeyName() string {
+	if c.ToggleHotkey == "" {
+		return DefaultToggleHotkey
+	}
+	return c.ToggleHotkey
+}
+
+// toggleHotkey returns the hotkey that disables or enables RightHand, falling
+// back to DefaultToggleHotkey.
+func (c RightHandConfig) toggleHotkey() hotkey {
+	h, err := parseHotkey(c.toggleHotkeyName())
+	if err != nil {
+		h, _ = parseHotkey(DefaultToggleHotkey)
+	}
+	return h
+}
+
+// toggleEnabled enables or disables RightHand, persisting the state if configured.
+// Disabling it stops listening and drops the commands not yet handled.
+func (app *App) toggleEnabled() {
+	disabled := !app.disabled.Load()
+	app.disabled.Store(disabled)
+	if disabled {
+		app.haltListening()
+		fmt.Printf("💤 RightHand disabled (%s to enable)\n", app.config().toggleHotkeyName())
+	} else {
+		fmt.Println("✅ RightHand enabled")
+	}
+	app.showIdle()
+
+	cfg := *app.config()
+	if !cfg.RememberDisabled {
+		return
+	}
+	cfg.Disabled = disabled
+	app.setConfig(&cfg)
+	if err := saveConfig(cfg); err != nil {
+		log.Printf("Error saving config: %v", err)
+	}
+}
+
+// haltListening asks runMainLoop to stop listening and drop the utterances
+// not yet handled.
+func (app *App) haltListening() {
+	select {
+	case app.halt <- struct{}{}:
+	default: // a halt is already requested
+	}
+}
+
+// setState shows state, such as "Listening", in the status panel and menu bar.
+func (app *App) setState(state string) {
+	app.status.setState(state)
+	app.menu.setState(state)
+}
+
+// showIdle shows whether RightHand is ready or disabled in the status panel.
+func (app *App) showIdle() {
+	if app.disabled.Load() {
+		app.setState("Disabled")
+	} else {
+		app.setState("Ready")
+	}
+}
+
+// startCommand returns a context for handling a command that is cancelled by
+// cancelCommand, or by cancelAllCommands while the command is still running.
+func (app *App) startCommand(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	app.mu.Lock()
+	app.cancelInFlight = cancel
+	if app.commands == nil {
+		app.commands = make(map[int]context.CancelFunc)
+	}
+	id := app.nextCommand
+	app.nextCommand++
+	app.commands[id] = cancel
+	app.mu.Unlock()
+	return ctx, func() {
+		cancel()
+		app.mu.Lock()
+		delete(app.commands, id)
+		app.mu.Unlock()
+	}
+}
+
+// cancelHotkeyName returns the hotkey that cancels the command in progress,
+// as written in cancel_hotkey, for display.
+func (c RightHandConfig) cancelHotkeyName() string {
+	if c.CancelHotkey == "" {
+		return DefaultCancelHotkey
+	}
+	return c.CancelHotkey
+}
+
+// cancelHotkey returns the hotkey that cancels the command in progress,
+// falling back to DefaultCancelHotkey.
+func (c RightHandConfig) cancelHotkey() hotkey {
+	h, err := parseHotkey(c.cancelHotkeyName())
+	if err != nil {
+		h, _ = parseHotkey(DefaultCancelHotkey)
+	}
+	return h
+}
+
+// cancelCommand cancels the command currently being handled, if any.
+func (app *App) cancelCommand() {
+	app.mu.Lock()
+	cancel := app.cancelInFlight
+	app.cancelInFlight = nil
+	app.mu.Unlock()
+	if cancel != nil {
+		fmt.Println("🛑 Cancelling command...")
+		cancel()
+	}
+}
+
+// cancelAllCommands cancels every command still being handled, including those
+// waiting for their turn to type.
+func (app *App) cancelAllCommands() {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	for _, cancel := range app.commands {
+		cancel()
+	}
+	app.cancelInFlight = nil
+}
+
+// supersedeCommands cancels every command still being handled because a
+// newer one was started, for supersede_in_flight.
+func (app *App) supersedeCommands() {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if len(app.commands) > 0 {
+		fmt.Println("⏭️  Cancelling the previous command for the new one")
+	}
+	for _, cancel := range app.commands {
+		cancel()
+	}
+	app.cancelInFlight = nil
+}
+
 var systemPrompt = `You are an AI assistant that interprets transcribed voice input
 and translates it into commands or text inputs for various applications. 
 
@@ -238,36 +954,134 @@ Your current active program is %v. Adjust your interpretation based on this cont
 
 When interpreting commands, please indicate modifier keys such as Command, Option, Shift, 
 or Control using curly braces. For instance, use '{Command}+t' for opening a new tab.
+To type a literal curly brace, such as in code, double it: '{{' types '{' and '}}' types '}'.
 
 When outputting a command with a modifier key, use Shift as a modifier instead of including an uppercase character.
 
 Your output will be used as keyboard input for the active application.
 Return the input exactly as provided if you aren't confident in your answer.`
 
-// handleText handles text.
+// handleText handles text for the frontmost application.
 func (app *App) handleText(ctx context.Context, text string) {
-	activeApp := fmt.Sprint(cocoa.NSWorkspace_SharedWorkspace().FrontmostApplication().LocalizedName())
-	fmt.Printf("📱 Active app: %s\n", activeApp)
+	activeApp, bundleID := frontmostApp()
+	app.handleTextFor(ctx, text, activeApp, bundleID, "")
+}
+
+// handleTextFor handles text for the given application. With an intent, the
+// intent's prompt and examples are used instead of the application's.
+// It returns the text typed for a dictation or produced by the language
+// model, or "" if there is none.
+func (app *App) handleTextFor(ctx context.Context, text, activeApp, bundleID, intentName string) (output string) {
+	ctx, cancel := app.startCommand(ctx)
+	defer cancel()
+	turn := app.typing.ticket()
+	defer app.typing.done(turn)
 
+	cfg := app.config()
+	defer app.startCooldown(cfg)
+	defer app.showIdle()
+	if app.disabled.Load() {
+		fmt.Println("💤 RightHand is disabled, skipping command")
+		return
+	}
+	fmt.Printf("📱 Active app: %s\n", appName(activeApp))
+	if !app.allowCommand(cfg) {
+		return
+	}
+	if formatted := cfg.formatTranscript(activeApp, bundleID, text); formatted != text {
+		app.verbosef("formatted transcription: %q", formatted)
+		text = formatted
+	}
+
+	if name, steps, ok := cfg.macroFor(text); ok {
+		app.explainf("matched macro %q", name)
+		app.status.setCommand("macro " + name)
+		app.waitTurn(turn)
+		if app.focusTarget(cfg, activeApp, bundleID) {
+			app.runMacro(ctx, cfg, name, steps, activeApp, bundleID)
+		}
+		return
+	}
+
+	if len(cfg.Macros) > 0 {
+		app.explainf("no macro named %q", normalizeUtterance(text))
+	}
+
+	if trigger, expanded, ok, err := cfg.templateFor(text); ok {
+		app.explainf("matched template %q", trigger)
+		if err != nil {
+			log.Printf("Error expanding template %q: %v", trigger, err)
+			app.status.addError()
+			return
+		}
+		app.status.setCommand("template " + trigger)
+		app.waitTurn(turn)
+		if app.focusTarget(cfg, activeApp, bundleID) {
+			fmt.Printf("🧩 Expanding template %q\n", trigger)
+			app.typeOutput(ctx, cfg, expanded, activeApp, bundleID)
+		}
+		return
+	}
+
+	intent := cfg.intentFor(intentName)
+	if intent == nil && !cfg.interpretFor(activeApp, bundleID) {
+		app.explainf("dictation is on for %s, typing what was said", activeApp)
+		return app.dictate(ctx, cfg, turn, text, activeApp, bundleID)
+	}
+
+	// a leading "using <model>," picks the model for just this command
+	model, text := cfg.modelPrefix(text)
+	if model != "" {
+		fmt.Printf("🧠 Using %s for this command\n", model)
+		app.explainf("spoken model prefix selected %s", model)
+	}
+
+	prompt := fmt.Sprintf(systemPrompt, appName(activeApp))
+	if intent != nil {
+		prompt = intent.systemPrompt(appName(activeApp))
+	}
+	if cfg.JSONActions {
+		prompt += jsonActionsPrompt
+	}
 	messages := []schema.ChatMessage{
 		schema.SystemChatMessage{
-			Text: fmt.Sprintf(systemPrompt, activeApp),
+			Text: prompt,
 		},
 	}
+	if cfg.Context != "" {
+		messages = append(messages, schema.SystemChatMessage{
+			Text: "What the user is working on: " + cfg.Context,
+		})
+	}
 
 	// check for few-shot examples for the active app from the config:
-	// TODO(tmc): this would be faster as a map
-	nExamples := 0
-	for _, prog := range app.cfg.Programs {
-		if prog.Program != activeApp {
-			continue
+	language := cfg.Language
+	if language == languageAuto {
+		language, _ = app.language.Load().(string)
+	}
+	var examples []FewShotExample
+	if intent != nil {
+		examples = filterExamples(intent.Examples, language)
+		app.explainf("using the prompt and %d examples of intent %q", len(examples), intentName)
+	} else {
+		examples = cfg.examplesFor(activeApp, bundleID, language)
+		app.explainf("%s", cfg.explainProgram(activeApp, bundleID))
+		if prog := cfg.programFor(activeApp, bundleID); prog != nil && len(examples) < len(prog.Examples) {
+			app.explainf("using %d of %d examples for language %q", len(examples), len(prog.Examples), language)
+		}
+	}
+	for _, example := range examples {
+		if normalizeUtterance(example.Input) == normalizeUtterance(text) {
+			app.explainf("matched example %q, whose output is %q", example.Input, example.Output)
 		}
-		for _, example := range prog.Examples {
-			messages = append(messages, schema.HumanChatMessage{Text: example.Input})
-			messages = append(messages, schema.AIChatMessage{Text: example.Output})
+		output := example.Output
+		if _, script := appleScriptSnippet(output); cfg.JSONActions && !script {
+			output = chordsToActions(output)
 		}
-		nExamples = len(prog.Examples)
+		messages = append(messages, schema.HumanChatMessage{Text: example.Input})
+		messages = append(messages, schema.AIChatMessage{Text: output})
 	}
+	nExamples := len(examples)
 
 	if nExamples > 0 {
 		fmt.Printf("ℹ️  Using %d custom commands for %s\n", nExamples, activeApp)
@@ -276,93 +1090,367 @@ func (app *App) handleText(ctx context.Context, text string) {
 	// append the human message:
 	messages = append(messages, schema.HumanChatMessage{Text: text})
 
-	llmText, err := app.llm.Call(ctx, messages)
+	if cfg.PrintPrompt || cfg.Verbose {
+		printPrompt(messages)
+	}
+
+	llmText, err := app.callLLM(ctx, cfg, model, messages)
+	if ctx.Err() != nil {
+		fmt.Println("🛑 Command cancelled")
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Printf("⏱️  Language model did not respond within %v, skipping command\n", cfg.llmTimeout())
+		log.Printf("LLM call timed out after %v", cfg.llmTimeout())
+		app.status.addError()
+		return
+	}
 	if err != nil {
 		log.Printf("❌ Error processing command: %v", err)
+		app.status.addError()
 		return
 	}
+	if strings.TrimSpace(llmText) == strings.TrimSpace(text) {
+		log.Printf("Model echoed the input %q", text)
+		switch cfg.onEchoFor(activeApp, bundleID) {
+		case onEchoSkip:
+			fmt.Println("🤷 The model wasn't confident and returned what you said; not acting")
+			return
+		case onEchoDictate:
+			app.explainf("the model echoed the input, typing it as dictation")
+			return app.dictate(ctx, cfg, turn, text, activeApp, bundleID)
+		}
+	}
+	if !cfg.KeepCodeFences {
+		llmText = stripCodeFences(llmText)
+	}
+	if cfg.lowercaseFirstWordFor(activeApp, bundleID) {
+		llmText = lowercaseFirstWord(llmText)
+	}
+	if replaced := cfg.applyReplacements(llmText); replaced != llmText {
+		app.explainf("replacements changed the output from %q", llmText)
+		llmText = replaced
+	}
+	if n := utf8.RuneCountInString(llmText); cfg.MaxOutputChars > 0 && n > cfg.MaxOutputChars {
+		fmt.Printf("✂️  Output is %d characters, typing only the first %d (max_output_chars)\n", n, cfg.MaxOutputChars)
+		log.Printf("Truncating output of %d characters to max_output_chars %d: %q", n, cfg.MaxOutputChars, llmText)
+		llmText = string([]rune(llmText)[:cfg.MaxOutputChars])
+	}
+	output = llmText
 	fmt.Printf("🤖 Executing: %s\n", llmText)
-	simulateTyping(llmText)
+	app.status.setCommand(llmText)
+	entry := commandLogEntry{Time: time.Now(), Program: activeApp, BundleID: bundleID, Input: text, Output: llmText}
+	app.lastCommand.Store(&entry)
+	if cfg.LogCommands {
+		if err := appendCommandLog(entry); err != nil {
+			log.Printf("Error writing command log: %v", err)
+		}
+	}
+	if cfg.Webhook != nil && cfg.Webhook.URL != "" {
+		go postWebhook(context.WithoutCancel(ctx), *cfg.Webhook, entry)
+	}
+	app.waitTurn(turn)
+	if !app.focusTarget(cfg, activeApp, bundleID) {
+		return
+	}
+	if script, ok := appleScriptSnippet(llmText); ok {
+		app.explainf("output is an AppleScript snippet")
+		app.runScript(ctx, script)
+		return
+	}
+	if cfg.JSONActions {
+		actions, err := parseActions(llmText)
+		if err == nil {
+			app.explainf("output is %d JSON actions", len(actions))
+			app.execute(cfg, activeApp, bundleID, func(exec Executor) error {
+				return runActions(ctx, exec, actions)
+			})
+			return
+		}
+		log.Printf("Could not parse JSON actions, typing output as text: %v", err)
+	}
+	app.typeText(ctx, cfg, llmText, cfg.affixesFor(activeApp, bundleID), activeApp, bundleID)
+	return output
 }
 
-// keyTapPattern is a package-level compiled regular expression
-//
-// This regex is used to parse commands involving key presses.
-// The pattern:
-// 1. "\{" matches the literal opening brace
-// 2. "((?:[^\\}]+\\+)*[^\\}]+)" matches one or more modifiers, each followed by a '+', except for the last one
-// 3. "\\}" matches the literal closing brace
-// 4. "(?:\\+([A-Za-z]+))?" optionally matches a key press (any sequence of letters) preceded by a '+'
-// 5. "(?:[ ;])?" optionally matches a trailing space or semicolon
-var keyTapPattern = regexp.MustCompile(`\{((?:[^\}]+\+)*[^\}]+)\}(?:\+([A-Za-z1-9]+))?(?:[ ;])?`)
-
-// Helper function to simulate key tapping with given modifiers and key
-func keyTapWithModifiers(modifiers []any, key string) {
-	robotgo.KeySleep = 100
-	robotgo.KeyTap(key, modifiers...)
-	robotgo.KeyTap("shift")            // undo modifiers
-	time.Sleep(100 * time.Millisecond) // slight delay to allow for key press to register
-}
-
-func extractModifiersAndKeyFromMatch(text string, match []int) ([]any, string) {
-	// Map of modifiers to their representation for robotgo
-	modifierMap := map[string]string{
-		"Command": "command",
-		"Shift":   "shift",
-		"Option":  "alt",
-		"Control": "ctrl",
-		"Tab":     "tab",
-		"Enter":   "enter",
-	}
-
-	// Extract the modifier keys
-	modifierKeys := strings.Split(text[match[2]:match[3]], "+")
-	modifiers := make([]any, 0, len(modifierKeys))
-	key := ""
-
-	// see if we have a key (check index 4)
-	if match[4] != -1 {
-		key = text[match[4]:match[5]]
-	} else {
-		key = modifierMap[modifierKeys[len(modifierKeys)-1]]
-		modifierKeys = modifierKeys[:len(modifierKeys)-1] // Remove the last element (the key)
+// dictate types text as said, as in dictation mode, once it is turn's turn
+// to type. It returns the text typed.
+func (app *App) dictate(ctx context.Context, cfg *RightHandConfig, turn uint64, text, activeApp, bundleID string) string {
+	if cfg.lowercaseFirstWordFor(activeApp, bundleID) {
+		text = lowercaseFirstWord(text)
+	}
+	fmt.Printf("⌨️  Typing: %s\n", text)
+	app.status.setCommand(text)
+	app.waitTurn(turn)
+	if app.focusTarget(cfg, activeApp, bundleID) {
+		app.typeDictation(ctx, cfg, text, cfg.affixesFor(activeApp, bundleID), activeApp, bundleID)
 	}
+	return text
+}
 
-	for _, modifier := range modifierKeys {
-		modifierKey, exists := modifierMap[modifier]
-		if !exists {
-			log.Printf("Unknown modifier: %s", modifier)
-			continue
+// waitTurn waits until earlier commands have finished typing.
+func (app *App) waitTurn(turn uint64) {
+	if n := app.typing.ahead(turn); n > 0 {
+		fmt.Printf("⏳ Waiting for %d earlier command(s) to finish...\n", n)
+	}
+	app.typing.wait(turn)
+}
+
+// focusTarget focuses the configured target window for the application, if any.
+// It reports false if the command should be skipped because no window matches.
+func (app *App) focusTarget(cfg *RightHandConfig, activeApp, bundleID string) bool {
+	pattern := cfg.targetWindowFor(activeApp, bundleID)
+	if pattern != "" {
+		app.explainf("target window %q", pattern)
+	}
+	if pattern == "" || focusWindow(pattern) {
+		return true
+	}
+	fmt.Printf("⚠️  No window matches %q, skipping command\n", pattern)
+	log.Printf("No window matches target_window %q", pattern)
+	return false
+}
+
+// typeText types text with simulateTyping between the given affixes into the
+// given application, entering newlines according to its newline_mode, and
+// undoing it if cancelled and so configured. It reports false if typing was
+// cancelled or failed.
+func (app *App) typeText(ctx context.Context, cfg *RightHandConfig, text string, wrap affixes, activeApp, bundleID string) bool {
+	newlines := cfg.newlineModeFor(activeApp, bundleID)
+	switch cfg.OutputTarget {
+	case outputTargetShell:
+		return app.runOutputCommand(ctx, cfg, wrap.prefix+text+wrap.suffix)
+	case outputTargetReview:
+		return app.reviewOutput(ctx, cfg, text, activeApp, bundleID, func(exec Executor, text string) error {
+			return wrap.around(exec, func() error {
+				return simulateTyping(ctx, exec, text, newlines)
+			})
+		})
+	}
+	return app.execute(cfg, activeApp, bundleID, func(exec Executor) error {
+		return wrap.around(exec, func() error {
+			return simulateTyping(ctx, exec, text, newlines)
+		})
+	})
+}
+
+// typeOutput runs output as AppleScript if it is a snippet, or types it into
+// the given application with typeText. It reports false if the output was
+// cancelled or failed.
+func (app *App) typeOutput(ctx context.Context, cfg *RightHandConfig, output, activeApp, bundleID string) bool {
+	if script, ok := appleScriptSnippet(output); ok {
+		return app.runScript(ctx, script)
+	}
+	return app.typeText(ctx, cfg, output, affixes{}, activeApp, bundleID)
+}
+
+// runScript runs an AppleScript snippet from an example output or macro step.
+// It reports false if the script was cancelled or failed.
+func (app *App) runScript(ctx context.Context, script string) bool {
+	fmt.Println("📜 Running AppleScript")
+	if err := runAppleScriptContext(ctx, script); err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("🛑 Script cancelled")
+			return false
 		}
-		modifiers = append(modifiers, modifierKey)
+		fmt.Printf("❌ Error running AppleScript: %v\n", err)
+		log.Printf("Error running AppleScript: %v", err)
+		app.status.addError()
+		return false
 	}
+	return true
+}
 
-	//fmt.Fprintln(os.Stderr, "righthand: modifiers:", modifiers, "key:", key)
-	return modifiers, key
+// runOutputCommand runs output_command with output on its standard input,
+// instead of typing the output. It reports false if the command was cancelled or failed.
+func (app *App) runOutputCommand(ctx context.Context, cfg *RightHandConfig, output string) bool {
+	fmt.Printf("🐚 Sending output to %s\n", cfg.OutputCommand)
+	cmd := exec.CommandContext(ctx, "sh", "-c", cfg.OutputCommand)
+	cmd.Stdin = strings.NewReader(output)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		fmt.Print(string(out))
+	}
+	if ctx.Err() != nil {
+		fmt.Println("🛑 Output command cancelled")
+		return false
+	}
+	if err != nil {
+		fmt.Printf("❌ Error running output command: %v\n", err)
+		log.Printf("Error running output_command %q: %v", cfg.OutputCommand, err)
+		app.status.addError()
+		return false
+	}
+	return true
 }
 
-func simulateTyping(text string) {
-	matches := keyTapPattern.FindAllStringSubmatchIndex(text, -1)
+// typeDictation types text with typeDictation between the given affixes into the given application,
+// undoing it if cancelled and so configured. It reports false if typing was cancelled or failed.
+func (app *App) typeDictation(ctx context.Context, cfg *RightHandConfig, text string, wrap affixes, activeApp, bundleID string) bool {
+	switch cfg.OutputTarget {
+	case outputTargetShell:
+		return app.runOutputCommand(ctx, cfg, wrap.prefix+text+wrap.suffix)
+	case outputTargetReview:
+		return app.reviewOutput(ctx, cfg, text, activeApp, bundleID, func(exec Executor, text string) error {
+			return wrap.around(exec, func() error {
+				return typeDictation(ctx, exec, text, cfg.dictationKeys())
+			})
+		})
+	}
+	return app.execute(cfg, activeApp, bundleID, func(exec Executor) error {
+		return wrap.around(exec, func() error {
+			return typeDictation(ctx, exec, text, cfg.dictationKeys())
+		})
+	})
+}
 
-	lastIndex := 0
-	for _, match := range matches {
-		// Type the text before the match as normal
-		if lastIndex != match[0] {
-			fmt.Fprintln(os.Stderr, "righthand: typing text:", text[lastIndex:match[0]])
-			robotgo.TypeStr(text[lastIndex:match[0]])
+// execute runs typing with the configured executor, undoing it if it was
+// cancelled and so configured. Typing is skipped while secure input is on,
+// since macOS would drop it. It reports false if typing was cancelled, skipped, or failed.
+//
+// Pasted text is left on the clipboard if preserve_clipboard is false for the
+// given application, the one the command was captured for.
+func (app *App) execute(cfg *RightHandConfig, activeApp, bundleID string, typing func(Executor) error) bool {
+	exec := app.executor
+	if exec == nil {
+		var err error
+		if exec, err = newExecutor(cfg.Executor, cfg.PasteboardType); err != nil {
+			log.Printf("Error creating executor: %v", err)
+			return false
+		}
+	}
+	noRestore := !cfg.preserveClipboardFor(activeApp, bundleID)
+	if e, ok := exec.(clipboardExecutor); ok {
+		e.noRestore = noRestore
+		exec = e
+	}
+	if cfg.CharByChar && cfg.Executor != executorLog && cfg.Executor != executorClipboard {
+		exec = charByChar{Executor: exec, delay: cfg.charDelay()}
+	}
+	if cfg.PasteThreshold > 0 && cfg.Executor != executorLog {
+		exec = pasteLongText{Executor: exec, threshold: cfg.PasteThreshold, pasteboardType: cfg.PasteboardType, noRestore: noRestore}
+	}
+	if cfg.EchoTyped && cfg.Executor != executorLog {
+		exec = echoTyped{Executor: exec}
+	}
+	if cfg.Executor != executorLog && secureInputEnabled() {
+		fmt.Println("🔒 Secure input is on (is a password field focused?), so macOS would drop typed input; skipping command")
+		log.Printf("Skipping typing: secure event input is enabled")
+		app.status.addError()
+		return false
+	}
+	if cfg.RefocusApp {
+		app.refocus()
+	}
+	if cfg.PreTypeDelayMs > 0 {
+		time.Sleep(time.Duration(cfg.PreTypeDelayMs) * time.Millisecond)
+	}
+	var before string
+	if cfg.VerifyFocus {
+		before, _ = frontmostApp()
+	}
+	err := typing(exec)
+	if cfg.VerifyFocus {
+		if after, _ := frontmostApp(); after != before {
+			fmt.Printf("⚠️  Focus moved from %s to %s while typing; some input may have gone to the wrong app\n", before, after)
+			log.Printf("Focus changed from %q to %q while typing", before, after)
+			app.status.addError()
 		}
-		lastIndex = match[1] + 1 // Update lastIndex, adding 1 to ignore the trailing space
+	}
+	var cancelled *typingCancelledError
+	if errors.As(err, &cancelled) {
+		fmt.Println("🛑 Typing cancelled")
+		if cfg.UndoOnCancel {
+			undoTyping(exec, cancelled.typed)
+		}
+		return false
+	}
+	if err != nil {
+		fmt.Printf("❌ Error typing: %v\n", err)
+		log.Printf("Error typing: %v", err)
+		app.status.addError()
+		return false
+	}
+	return true
+}
 
-		modifiers, key := extractModifiersAndKeyFromMatch(text, match)
+// nsApplicationActivateIgnoringOtherApps is the NSApplicationActivationOptions
+// flag to activate an application regardless of which application is active.
+const nsApplicationActivateIgnoringOtherApps = 1 << 1
 
-		// Simulate key press
-		keyTapWithModifiers(modifiers, key)
+// frontmostPID returns the process ID of the frontmost application, or 0 if there is none.
+func frontmostPID() int32 {
+	frontmost := cocoa.NSWorkspace_SharedWorkspace().FrontmostApplication()
+	if frontmost.Pointer() == 0 {
+		return 0
 	}
+	return int32(frontmost.Get("processIdentifier").Int())
+}
+
+// rememberFrontmost records the frontmost application for refocus_app,
+// unless it is RightHand itself.
+func (app *App) rememberFrontmost() {
+	if pid := frontmostPID(); pid != 0 && pid != int32(os.Getpid()) {
+		app.previousApp.Store(pid)
+	}
+}
 
-	// Type the rest of the text after the last match
-	if lastIndex < len(text) {
-		fmt.Fprintln(os.Stderr, "righthand: typing remainder of text:", text[lastIndex:])
-		time.Sleep(100 * time.Millisecond) // slight delay to allow for key press to registerV
-		robotgo.TypeStr(text[lastIndex:])
+// refocus activates the application that was frontmost before RightHand if
+// RightHand itself has become frontmost, so input isn't typed into it.
+func (app *App) refocus() {
+	pid := app.previousApp.Load()
+	if pid == 0 || frontmostPID() != int32(os.Getpid()) {
+		return
+	}
+	app.verbosef("RightHand is frontmost, activating the previous app (pid %d)", pid)
+	activateProcess(pid)
+}
+
+// activateProcess activates the application with the given process ID.
+func activateProcess(pid int32) {
+	objc.Get("NSRunningApplication").
+		Send("runningApplicationWithProcessIdentifier:", pid).
+		Send("activateWithOptions:", nsApplicationActivateIgnoringOtherApps)
+	time.Sleep(100 * time.Millisecond) // allow the focus change to take effect
+}
+
+// focusWindow raises and activates the frontmost window whose title matches pattern.
+// It reports whether a matching window was found.
+func focusWindow(pattern string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("Invalid window pattern %q: %v", pattern, err)
+		return false
+	}
+	for _, w := range listWindows() {
+		if !re.MatchString(w.Title) {
+			continue
+		}
+		if !raiseWindow(w) {
+			log.Printf("Could not raise window %q; check Accessibility permissions", w.Title)
+		}
+		activateProcess(int32(w.PID))
+		return true
+	}
+	return false
+}
+
+// callLLM calls the language model, giving up after the configured timeout.
+// If model is set, it is used instead of the configured model.
+// The timeout applies to each call, so retries each get the full duration.
+func (app *App) callLLM(ctx context.Context, cfg *RightHandConfig, model string, messages []schema.ChatMessage) (string, error) {
+	llm := app.llm
+	if model != "" && model != cfg.LLMModel {
+		var err error
+		if llm, err = app.llmFor(cfg, model); err != nil {
+			return "", err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.llmTimeout())
+	defer cancel()
+	text, err := llm.Call(ctx, messages)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("calling language model: %w", ctx.Err())
 	}
+	return text, err
 }
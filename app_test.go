@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// fakeLLM answers every call with output, recording the messages sent to it.
+type fakeLLM struct {
+	output string
+
+	mu    sync.Mutex
+	calls [][]schema.ChatMessage
+}
+
+func (m *fakeLLM) Call(ctx context.Context, messages []schema.ChatMessage, options ...llms.CallOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, messages)
+	return m.output, nil
+}
+
+// recordingExecutor records input instead of performing it.
+type recordingExecutor struct {
+	mu    sync.Mutex
+	input []string
+}
+
+func (e *recordingExecutor) Type(text string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.input = append(e.input, "type "+text)
+	return nil
+}
+
+func (e *recordingExecutor) KeyTap(key string, modifiers ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.input = append(e.input, "key "+strings.Join(append(modifiers, key), "+"))
+	return nil
+}
+
+// recorded returns the input recorded so far.
+func (e *recordingExecutor) recorded() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.input)
+}
+
+// newTestApp returns an App without audio that handles text with llm and
+// performs input with exec.
+func newTestApp(cfg RightHandConfig, llm chatModel, exec Executor) *App {
+	cfg.indexPrograms()
+	app := &App{
+		listeningToggle: make(chan string, 1),
+		relisten:        make(chan string, 1),
+		retry:           make(chan struct{}, 1),
+		halt:            make(chan struct{}, 1),
+		llm:             llm,
+		typing:          newTypingQueue(),
+		executor:        exec,
+	}
+	app.setConfig(&cfg)
+	return app
+}
+
+// TestReloadConfigWhileHandlingText reloads the config while commands are
+// handled; run it with -race to check that the two don't race.
+func TestReloadConfigWhileHandlingText(t *testing.T) {
+	*flagConfig = filepath.Join(t.TempDir(), "config.yaml")
+	t.Cleanup(func() { *flagConfig = "" })
+	cfg := RightHandConfig{
+		Programs: []ProgramFewShotExamples{{
+			Program:  "Terminal",
+			BundleID: "com.apple.Terminal",
+			Examples: []FewShotExample{{Input: "new tab", Output: "{Command}+t"}},
+		}},
+	}
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	exec := &recordingExecutor{}
+	app := newTestApp(cfg, &fakeLLM{output: "{Command}+t"}, exec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := app.reloadConfig(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	const n = 20
+	for i := 0; i < n; i++ {
+		app.handleTextFor(context.Background(), "open a new tab", "Terminal", "com.apple.Terminal", "")
+	}
+	cancel()
+	<-done
+
+	if got := exec.recorded(); len(got) != n || got[0] != "key command+t" {
+		t.Errorf("recorded input %q, want %d times %q", got, n, "key command+t")
+	}
+}
+
+// TestHandleTextWithoutFrontmostApp handles a command when there is no
+// frontmost application, as on the desktop, for which frontmostApp returns
+// empty strings.
+func TestHandleTextWithoutFrontmostApp(t *testing.T) {
+	cfg := RightHandConfig{
+		Programs: []ProgramFewShotExamples{{
+			Program:  "Terminal",
+			Examples: []FewShotExample{{Input: "new tab", Output: "{Command}+t"}},
+		}},
+	}
+	llm := &fakeLLM{output: "hello"}
+	exec := &recordingExecutor{}
+	app := newTestApp(cfg, llm, exec)
+
+	if prog := app.config().programFor("", ""); prog != nil {
+		t.Errorf("programFor(\"\", \"\") = %q, want nil", prog.Program)
+	}
+	if output := app.handleTextFor(context.Background(), "say hello", "", "", ""); output != "hello" {
+		t.Errorf("handleTextFor returned %q, want %q", output, "hello")
+	}
+	if len(llm.calls) != 1 {
+		t.Fatalf("language model called %d times, want 1", len(llm.calls))
+	}
+	messages := llm.calls[0]
+	if len(messages) != 2 {
+		t.Errorf("sent %d messages, want the system prompt and the command without examples", len(messages))
+	}
+	if prompt := messages[0].GetText(); !strings.Contains(prompt, "active program is Unknown") {
+		t.Errorf("system prompt %q doesn't name the app Unknown", prompt)
+	}
+	if got := exec.recorded(); !slices.Equal(got, []string{"type hello"}) {
+		t.Errorf("recorded input %q, want %q", got, []string{"type hello"})
+	}
+}
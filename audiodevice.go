@@ -0,0 +1,92 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework CoreAudio -framework CoreFoundation
+#include <CoreAudio/CoreAudio.h>
+
+static const AudioObjectPropertyAddress defaultInputDeviceAddress = {
+	kAudioHardwarePropertyDefaultInputDevice,
+	kAudioObjectPropertyScopeGlobal,
+	0, // kAudioObjectPropertyElementMain
+};
+
+static volatile int defaultInputDeviceChanged;
+
+static OSStatus onDefaultInputDeviceChanged(AudioObjectID obj, UInt32 n, const AudioObjectPropertyAddress *addrs, void *data) {
+	__sync_lock_test_and_set(&defaultInputDeviceChanged, 1);
+	return noErr;
+}
+
+static OSStatus watchDefaultInputDevice(void) {
+	return AudioObjectAddPropertyListener(kAudioObjectSystemObject, &defaultInputDeviceAddress, onDefaultInputDeviceChanged, NULL);
+}
+
+static int takeDefaultInputDeviceChanged(void) {
+	return __sync_lock_test_and_set(&defaultInputDeviceChanged, 0);
+}
+
+static AudioDeviceID defaultInputDevice(void) {
+	AudioDeviceID id = kAudioObjectUnknown;
+	UInt32 size = sizeof(id);
+	if (AudioObjectGetPropertyData(kAudioObjectSystemObject, &defaultInputDeviceAddress, 0, NULL, &size, &id) != noErr) {
+		return kAudioObjectUnknown;
+	}
+	return id;
+}
+
+static int audioDeviceName(AudioDeviceID id, char *buf, int len) {
+	AudioObjectPropertyAddress addr = {
+		kAudioObjectPropertyName,
+		kAudioObjectPropertyScopeGlobal,
+		0,
+	};
+	CFStringRef name = NULL;
+	UInt32 size = sizeof(name);
+	if (AudioObjectGetPropertyData(id, &addr, 0, NULL, &size, &name) != noErr || name == NULL) {
+		return 0;
+	}
+	Boolean ok = CFStringGetCString(name, buf, len, kCFStringEncodingUTF8);
+	CFRelease(name);
+	return ok;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// inputDevice is a CoreAudio audio input device.
+type inputDevice struct {
+	ID   uint32
+	Name string
+}
+
+// defaultInputDevice returns the system default audio input device.
+// It reports false if there is none.
+func defaultInputDevice() (inputDevice, bool) {
+	id := C.defaultInputDevice()
+	if id == 0 { // kAudioObjectUnknown
+		return inputDevice{}, false
+	}
+	buf := make([]byte, 256)
+	dev := inputDevice{ID: uint32(id)}
+	if C.audioDeviceName(id, (*C.char)(unsafe.Pointer(&buf[0])), C.int(len(buf))) != 0 {
+		dev.Name = C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
+	}
+	return dev, true
+}
+
+// watchInputDevice registers for CoreAudio notifications about changes to the default input device.
+func watchInputDevice() error {
+	if status := C.watchDefaultInputDevice(); status != 0 {
+		return fmt.Errorf("could not watch default input device: OSStatus %d", int(status))
+	}
+	return nil
+}
+
+// inputDeviceChanged reports whether the default input device changed since it was last called.
+func inputDeviceChanged() bool {
+	return C.takeDefaultInputDeviceChanged() != 0
+}
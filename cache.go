@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// modelCacheDir returns the directory whisper models are downloaded to.
+func modelCacheDir() string {
+	return filepath.Dir(whisperModelPath(""))
+}
+
+// printCacheInfo prints the location of the model cache and the size of each model in it.
+func printCacheInfo() error {
+	paths, err := filepath.Glob(whisperModelPath("*"))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Model cache:", modelCacheDir())
+	var total int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		fmt.Printf("  %-30s %6d MB\n", filepath.Base(path), info.Size()/1e6)
+	}
+	fmt.Printf("%d models, %d MB in total\n", len(paths), total/1e6)
+	return nil
+}
+
+// clearCache removes the downloaded whisper models after asking for confirmation.
+func clearCache() error {
+	paths, err := filepath.Glob(whisperModelPath("*"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Println("No whisper models downloaded to", modelCacheDir())
+		return nil
+	}
+	if err := printCacheInfo(); err != nil {
+		return err
+	}
+	fmt.Print("Remove these models? They will be downloaded again when needed. [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		fmt.Println("Nothing removed")
+		return nil
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %d models\n", len(paths))
+	return nil
+}
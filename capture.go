@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+// audioCaptureChunk is the duration of each chunk of audio sent to the main
+// loop. It is short so that the level meter follows speech closely and
+// capture stops soon after it is asked to.
+const audioCaptureChunk = 100 * time.Millisecond
+
+// audioCaptureBuffer is the number of audio chunks buffered between capture
+// and the main loop, about a minute of audio.
+const audioCaptureBuffer = 640
+
+// audioInputFrames is the number of samples read from the input stream at a
+// time, one audioCaptureChunk.
+const audioInputFrames = whisper.SampleRate / 10
+
+// audioInput records mono audio at the whisper sample rate from the default
+// input device.
+type audioInput struct {
+	stream *portaudio.Stream
+	buf    []float32 // filled by each read of the stream
+}
+
+// openAudioInput initializes PortAudio and opens a stream on the default
+// input device. PortAudio scans the devices when it is initialized, so a
+// device added since the last audioInput was closed is seen.
+func openAudioInput() (*audioInput, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("initializing portaudio: %w", err)
+	}
+	in := &audioInput{buf: make([]float32, audioInputFrames)}
+	stream, err := portaudio.OpenDefaultStream(1, 0, whisper.SampleRate, len(in.buf), in.buf)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, fmt.Errorf("opening default input stream: %w", err)
+	}
+	in.stream = stream
+	return in, nil
+}
+
+// start starts recording.
+func (in *audioInput) start() error {
+	return in.stream.Start()
+}
+
+// stop stops recording.
+func (in *audioInput) stop() error {
+	return in.stream.Stop()
+}
+
+// read records for about duration and returns the samples.
+func (in *audioInput) read(duration time.Duration) ([]float32, error) {
+	n := int(duration.Seconds() * whisper.SampleRate / audioInputFrames)
+	samples := make([]float32, 0, n*audioInputFrames)
+	for i := 0; i < n; i++ {
+		if err := in.stream.Read(); err != nil {
+			return nil, err
+		}
+		samples = append(samples, in.buf...)
+	}
+	return samples, nil
+}
+
+// close closes the stream and terminates PortAudio, so the next
+// openAudioInput rescans the devices.
+func (in *audioInput) close() error {
+	err := in.stream.Close()
+	if terr := portaudio.Terminate(); err == nil {
+		err = terr
+	}
+	return err
+}
+
+// audioCapture collects audio in its own goroutine, so capture isn't held up
+// while the main loop handles other events.
+type audioCapture struct {
+	chunks  chan []float32
+	cancel  context.CancelFunc
+	done    chan struct{}
+	dropped atomic.Int64 // chunks discarded because chunks was full
+}
+
+// startAudioCapture starts collecting audio from in, which must already be started.
+func startAudioCapture(ctx context.Context, in *audioInput) *audioCapture {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &audioCapture{
+		chunks: make(chan []float32, audioCaptureBuffer),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go c.run(ctx, in)
+	return c
+}
+
+func (c *audioCapture) run(ctx context.Context, in *audioInput) {
+	defer close(c.done)
+	for ctx.Err() == nil {
+		buf, err := in.read(audioCaptureChunk)
+		if err != nil {
+			log.Printf("error collecting audio data: %v", err)
+			continue
+		}
+		select {
+		case c.chunks <- buf:
+		default:
+			c.dropped.Add(1)
+		}
+	}
+}
+
+// stop stops collecting audio and returns the chunks not yet received from c.chunks.
+func (c *audioCapture) stop() [][]float32 {
+	c.cancel()
+	<-c.done
+	close(c.chunks)
+	var rest [][]float32
+	for buf := range c.chunks {
+		rest = append(rest, buf)
+	}
+	return rest
+}
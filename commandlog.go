@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// commandLogEntry is a handled command recorded in the command log.
+type commandLogEntry struct {
+	Time     time.Time `json:"time"`
+	Program  string    `json:"program"`
+	BundleID string    `json:"bundle_id,omitempty"`
+	Input    string    `json:"input"`
+	Output   string    `json:"output"`
+}
+
+// commandLogPath returns the path of the command log, next to the config file.
+func commandLogPath() string {
+	return filepath.Join(filepath.Dir(configPath()), "commands.jsonl")
+}
+
+// appendCommandLog appends an entry to the command log.
+func appendCommandLog(entry commandLogEntry) error {
+	f, err := os.OpenFile(commandLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// readCommandLog reads all entries from the command log.
+func readCommandLog() ([]commandLogEntry, error) {
+	f, err := os.Open(commandLogPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []commandLogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry commandLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", commandLogPath(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// promoteExamples adds the commands in the command log to cfg as few-shot examples
+// for their programs, skipping any that are already present, and saves the config.
+// It returns the number of examples added.
+func promoteExamples(cfg RightHandConfig) (int, error) {
+	entries, err := readCommandLog()
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, entry := range entries {
+		if addExample(&cfg, entry) {
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, saveConfig(cfg)
+}
+
+// addExample adds entry to cfg as a few-shot example for its program, adding
+// a program entry if needed. It reports false if entry is incomplete or the
+// example is already present.
+func addExample(cfg *RightHandConfig, entry commandLogEntry) bool {
+	if entry.Program == "" || entry.Input == "" || entry.Output == "" {
+		return false
+	}
+	example := FewShotExample{Input: entry.Input, Output: entry.Output}
+	i := programIndex(cfg.Programs, entry.Program)
+	if i < 0 {
+		cfg.Programs = append(cfg.Programs, ProgramFewShotExamples{Program: entry.Program})
+		i = len(cfg.Programs) - 1
+	}
+	if hasExample(cfg.Programs[i].Examples, example) {
+		return false
+	}
+	cfg.Programs[i].Examples = append(cfg.Programs[i].Examples, example)
+	return true
+}
+
+// confirmHotkey returns the hotkey that saves the last command as an
+// example, and false if it is not configured.
+func (c RightHandConfig) confirmHotkey() (hotkey, bool) {
+	if c.ConfirmHotkey == "" {
+		return hotkey{}, false
+	}
+	h, err := parseHotkey(c.ConfirmHotkey)
+	return h, err == nil
+}
+
+// maxConfirmedExamples returns the number of examples for an app beyond which
+// confirm_hotkey saves no more, falling back to DefaultMaxConfirmedExamples.
+func (c RightHandConfig) maxConfirmedExamples() int {
+	if c.MaxConfirmedExamples <= 0 {
+		return DefaultMaxConfirmedExamples
+	}
+	return c.MaxConfirmedExamples
+}
+
+// confirmLastCommand saves the last command interpreted by the language model
+// as a few-shot example for its app, unless it is already an example or the
+// app has max_confirmed_examples.
+func (app *App) confirmLastCommand() {
+	entry := app.lastCommand.Swap(nil)
+	if entry == nil {
+		fmt.Println("📚 No command to save as an example")
+		return
+	}
+	cfg := *app.config()
+	if i := programIndex(cfg.Programs, entry.Program); i >= 0 && len(cfg.Programs[i].Examples) >= cfg.maxConfirmedExamples() {
+		fmt.Printf("📚 %s already has %d examples, not saving another\n", entry.Program, len(cfg.Programs[i].Examples))
+		return
+	}
+	// copy the program entries so the config in use isn't modified
+	cfg.Programs = slices.Clone(cfg.Programs)
+	for i := range cfg.Programs {
+		cfg.Programs[i].Examples = slices.Clip(cfg.Programs[i].Examples)
+	}
+	if !addExample(&cfg, *entry) {
+		fmt.Printf("📚 %q is already an example for %s\n", entry.Input, entry.Program)
+		return
+	}
+	cfg.indexPrograms()
+	app.setConfig(&cfg)
+	if err := saveConfig(cfg); err != nil {
+		log.Printf("Error saving config: %v", err)
+		app.status.addError()
+		return
+	}
+	fmt.Printf("📚 Saved %q → %q as an example for %s\n", entry.Input, entry.Output, entry.Program)
+}
+
+// programIndex returns the index of the entry for program, or -1 if there is none.
+func programIndex(programs []ProgramFewShotExamples, program string) int {
+	for i, prog := range programs {
+		if prog.Program == program {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasExample reports whether examples contains example.
+func hasExample(examples []FewShotExample, example FewShotExample) bool {
+	for _, e := range examples {
+		if e == example {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+// usage prints the command-line usage, including the subcommands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: righthand [flags] [command]")
+	fmt.Fprintln(out, "\nCommands:")
+	fmt.Fprintln(out, "  run                   listen for voice commands (default)")
+	fmt.Fprintln(out, "  config edit           edit the config file and check it for errors")
+	fmt.Fprintln(out, "  config path           print the location of the config file")
+	fmt.Fprintln(out, "  models list           list the downloaded whisper models")
+	fmt.Fprintln(out, "  transcribe FILE.wav   transcribe a WAV file and print the text")
+	fmt.Fprintln(out, "  transcribe DIR        transcribe each WAV file in DIR, printing JSON lines")
+	fmt.Fprintln(out, "\nWhile running:")
+	fmt.Fprintln(out, "  Command + Control     start listening; press again to stop and run the command")
+	fmt.Fprintf(out, "  %-21s cancel the command in progress (cancel_hotkey)\n", DefaultCancelHotkey)
+	fmt.Fprintf(out, "  %-21s disable or enable RightHand (toggle_hotkey)\n", DefaultToggleHotkey)
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// runCommand runs a subcommand other than run.
+func runCommand(cfg RightHandConfig, command string, args []string) error {
+	switch command {
+	case "config":
+		return runConfigCommand(args)
+	case "models":
+		return runModelsCommand(cfg, args)
+	case "transcribe":
+		return runTranscribeCommand(cfg, args)
+	default:
+		return fmt.Errorf("unknown command %q (run righthand -h for usage)", command)
+	}
+}
+
+// runConfigCommand runs the config subcommand.
+func runConfigCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: righthand config edit|path")
+	}
+	switch args[0] {
+	case "path":
+		fmt.Println(configPath())
+		return nil
+	case "edit":
+		return editConfig()
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// editConfig opens the config file in $EDITOR, or the default text editor,
+// then reports any problems with the edited file.
+func editConfig() error {
+	if _, err := loadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: the config file currently has errors:", err)
+	}
+	var cmd *exec.Cmd
+	if editor := strings.Fields(os.Getenv("EDITOR")); len(editor) > 0 {
+		cmd = exec.Command(editor[0], append(editor[1:], configPath())...)
+	} else {
+		cmd = exec.Command("open", "-W", "-t", configPath())
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running editor: %w", err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("the edited config file could not be loaded: %w", err)
+	}
+	if !checkConfig(cfg) {
+		return errors.New("the edited config file is invalid")
+	}
+	return nil
+}
+
+// checkConfig validates cfg and checks the chords in it, printing each
+// problem found. It reports whether there were none.
+func checkConfig(cfg RightHandConfig) bool {
+	ok := true
+	setKeyMap(cfg.KeyMap)
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		ok = false
+	}
+	for _, err := range cfg.checkChords() {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		ok = false
+	}
+	for _, warning := range cfg.duplicatePrograms() {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	if ok {
+		fmt.Println("Config file OK")
+	}
+	return ok
+}
+
+// runModelsCommand runs the models subcommand.
+func runModelsCommand(cfg RightHandConfig, args []string) error {
+	if len(args) != 1 || args[0] != "list" {
+		return errors.New("usage: righthand models list")
+	}
+	paths, err := filepath.Glob(whisperModelPath("*"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Println("No whisper models downloaded to", modelCacheDir())
+		return nil
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "ggml-"), ".bin")
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		current := " "
+		if path == cfg.whisperModelFile() {
+			current = "*"
+		}
+		fmt.Printf("%s %-20s %6d MB\n", current, name, info.Size()/1e6)
+	}
+	return nil
+}
+
+// runTranscribeCommand runs the transcribe subcommand. Given a directory, it
+// transcribes each WAV file in it with transcribeDir.
+func runTranscribeCommand(cfg RightHandConfig, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: righthand transcribe FILE.wav|DIR")
+	}
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return transcribeDir(cfg, args[0])
+	}
+	samples, err := readWAV(args[0])
+	if err != nil {
+		return err
+	}
+	path, err := fetchWhisperModel(cfg)
+	if err != nil {
+		return err
+	}
+	t, err := newSegmentTranscriber(path)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+	segments, _, err := t.transcribe(samples, cfg.Language, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(segmentsText(segments))
+	return nil
+}
+
+// batchTranscription is the result for one file of transcribeDir.
+type batchTranscription struct {
+	File     string  `json:"file"`
+	Text     string  `json:"text"`
+	Duration float64 `json:"duration"` // of the audio, in seconds
+	Error    string  `json:"error,omitempty"`
+}
+
+// transcribeDir transcribes each WAV file in dir and its subdirectories,
+// writing one JSON line per file to standard output. A file that can't be
+// read or transcribed is reported in its line, and the rest are still done.
+func transcribeDir(cfg RightHandConfig, dir string) error {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".wav") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no WAV files in %s", dir)
+	}
+	path, err := fetchWhisperModel(cfg)
+	if err != nil {
+		return err
+	}
+	t, err := newSegmentTranscriber(path)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+	enc := json.NewEncoder(os.Stdout)
+	for i, path := range paths {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", i+1, len(paths), path)
+		result := batchTranscription{File: path}
+		samples, err := readWAV(path)
+		if err == nil {
+			result.Duration = float64(len(samples)) / whisper.SampleRate
+			var segments []whisper.Segment
+			segments, _, err = t.transcribe(samples, cfg.Language, nil)
+			result.Text = segmentsText(segments)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,14 +1,57 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/goccy/go-yaml"
 )
 
+// Values of the on_echo setting.
+const (
+	onEchoType    = "type"
+	onEchoSkip    = "skip"
+	onEchoDictate = "dictate"
+)
+
+// Values of the output_target setting.
+const (
+	outputTargetType   = "type"
+	outputTargetShell  = "shell"
+	outputTargetReview = "review"
+)
+
+// Values of the newline_mode setting.
+const (
+	newlineLiteral = "literal"
+	newlineEnter   = "enter"
+	newlineStrip   = "strip"
+)
+
+// Values of the dump_wav_format setting.
+const (
+	wavFormatPCM24   = "pcm24"
+	wavFormatPCM16   = "pcm16"
+	wavFormatFloat32 = "float32"
+)
+
+// Values of the capture_app_at setting.
+const (
+	captureAppAtStart = "start"
+	captureAppAtEnd   = "end"
+)
+
 var defaultConfig = RightHandConfig{
 	LLMModel:     "gpt-4",
+	LLMTimeout:   DefaultLLMTimeout,
 	WhisperModel: "base.en",
 	Programs: []ProgramFewShotExamples{
 		{
@@ -36,7 +79,12 @@ var defaultConfig = RightHandConfig{
 	},
 }
 
+// configPath returns the path of the configuration file: the one given with
+// -config, or config.yaml in the user's config directory.
 func configPath() string {
+	if *flagConfig != "" {
+		return *flagConfig
+	}
 	ucd, _ := os.UserConfigDir()
 	return filepath.Join(ucd, "righthand", "config.yaml")
 }
@@ -46,9 +94,12 @@ func loadConfig() (RightHandConfig, error) {
 	var config RightHandConfig
 	err := loadYaml(configPath(), &config)
 	if err != nil {
-		return defaultConfig, err
+		config = defaultConfig
 	}
-	return config, nil
+	config.indexPrograms()
+	config.compileReplacements()
+	config.compileTemplates()
+	return config, err
 }
 
 // saveConfig saves the configuration file for RightHand as yaml
@@ -56,6 +107,35 @@ func saveConfig(config RightHandConfig) error {
 	return saveYaml(configPath(), config)
 }
 
+// resetConfig replaces the configuration file with defaultConfig, first renaming
+// any existing file to a timestamped backup. It returns the backup path, or "" if
+// there was no file to back up.
+func resetConfig() (string, error) {
+	path := configPath()
+	backup := ""
+	if _, err := os.Stat(path); err == nil {
+		backup = fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+		if err := os.Rename(path, backup); err != nil {
+			return "", err
+		}
+	}
+	return backup, saveConfig(defaultConfig)
+}
+
+// exportConfig writes config to path with its secrets removed, for sharing:
+// the API key, the secrets file, and the webhook, whose URL and headers
+// often hold tokens, are left out, as is any password in llm_base_url.
+func exportConfig(config RightHandConfig, path string) error {
+	config.OpenAIAPIKey = ""
+	config.SecretsFile = ""
+	config.Webhook = nil
+	if u, err := url.Parse(config.LLMBaseURL); err == nil && u.User != nil {
+		u.User = nil
+		config.LLMBaseURL = u.String()
+	}
+	return saveYaml(path, config)
+}
+
 func loadYaml(path string, v *RightHandConfig) error {
 	f, err := os.Open(path)
 	// if not exists, write default config
@@ -82,23 +162,547 @@ func saveYaml(path string, v interface{}) error {
 
 }
 
+// quiet reports whether to skip the startup banner and instructions, for
+// quiet or -quiet.
+func (c RightHandConfig) quiet() bool {
+	return c.Quiet || c.QuietFlag
+}
+
+// validate reports problems with the configuration that would prevent RightHand from starting.
+func (c RightHandConfig) validate() error {
+	if c.LLMBaseURL != "" {
+		u, err := url.Parse(c.LLMBaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid llm_base_url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid llm_base_url %q: must be an absolute http or https URL", c.LLMBaseURL)
+		}
+	}
+	if c.MaxOutputChars < 0 {
+		return fmt.Errorf("invalid max_output_chars %d: must not be negative", c.MaxOutputChars)
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return fmt.Errorf("invalid min_confidence %v: must be between 0 and 1", c.MinConfidence)
+	}
+	switch c.DumpWAVFormat {
+	case "", wavFormatPCM24, wavFormatPCM16, wavFormatFloat32:
+	default:
+		return fmt.Errorf("invalid dump_wav_format %q: must be %q, %q, or %q", c.DumpWAVFormat, wavFormatPCM24, wavFormatPCM16, wavFormatFloat32)
+	}
+	switch c.CaptureAppAt {
+	case "", captureAppAtStart, captureAppAtEnd:
+	default:
+		return fmt.Errorf("invalid capture_app_at %q: must be %q or %q", c.CaptureAppAt, captureAppAtStart, captureAppAtEnd)
+	}
+	if c.Language != "" && strings.HasSuffix(c.WhisperModel, ".en") {
+		return fmt.Errorf("language %q requires a multilingual whisper_model, not %q", c.Language, c.WhisperModel)
+	}
+	if err := validateOnEcho(c.OnEcho); err != nil {
+		return err
+	}
+	switch c.OutputTarget {
+	case "", outputTargetType, outputTargetReview:
+	case outputTargetShell:
+		if c.OutputCommand == "" {
+			return errors.New("output_target shell requires output_command")
+		}
+	default:
+		return fmt.Errorf("invalid output_target %q: must be %q, %q, or %q", c.OutputTarget, outputTargetType, outputTargetShell, outputTargetReview)
+	}
+	if _, err := newExecutor(c.Executor, c.PasteboardType); err != nil {
+		return err
+	}
+	if c.EmergencyStop != "" {
+		if _, err := parseHotkey(c.EmergencyStop); err != nil {
+			return fmt.Errorf("invalid emergency_stop: %w", err)
+		}
+	}
+	if c.ToggleHotkey != "" {
+		if _, err := parseHotkey(c.ToggleHotkey); err != nil {
+			return fmt.Errorf("invalid toggle_hotkey: %w", err)
+		}
+	}
+	if c.CancelHotkey != "" {
+		if _, err := parseHotkey(c.CancelHotkey); err != nil {
+			return fmt.Errorf("invalid cancel_hotkey: %w", err)
+		}
+	}
+	if c.RetryHotkey != "" {
+		if _, err := parseHotkey(c.RetryHotkey); err != nil {
+			return fmt.Errorf("invalid retry_hotkey: %w", err)
+		}
+		if c.RetryWhisperModel == "" {
+			return errors.New("retry_hotkey requires retry_whisper_model")
+		}
+	}
+	if c.ConfirmHotkey != "" {
+		if _, err := parseHotkey(c.ConfirmHotkey); err != nil {
+			return fmt.Errorf("invalid confirm_hotkey: %w", err)
+		}
+	}
+	for name, intent := range c.Intents {
+		if _, err := parseHotkey(intent.Hotkey); err != nil {
+			return fmt.Errorf("invalid hotkey for intent %q: %w", name, err)
+		}
+	}
+	if err := c.checkHotkeyClashes(); err != nil {
+		return err
+	}
+	if c.Webhook != nil && c.Webhook.URL != "" {
+		if u, err := url.Parse(c.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid webhook url %q: must be an absolute http or https URL", c.Webhook.URL)
+		}
+	}
+	for i, r := range c.Replacements {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern for replacement %d: %w", i+1, err)
+		}
+	}
+	for i, t := range c.Templates {
+		if _, err := t.compile(); err != nil {
+			return fmt.Errorf("invalid template %d: %w", i+1, err)
+		}
+	}
+	if _, err := regexp.Compile(c.TargetWindow); err != nil {
+		return fmt.Errorf("invalid target_window: %w", err)
+	}
+	for _, prog := range c.Programs {
+		if _, err := regexp.Compile(prog.TargetWindow); err != nil {
+			return fmt.Errorf("invalid target_window for %s: %w", prog.Program, err)
+		}
+		if _, ok := c.Profiles[prog.Profile]; prog.Profile != "" && !ok {
+			return fmt.Errorf("unknown profile %q for %s", prog.Profile, prog.Program)
+		}
+		if err := validateOnEcho(prog.OnEcho); err != nil {
+			return fmt.Errorf("%w for %s", err, prog.Program)
+		}
+		switch prog.NewlineMode {
+		case "", newlineLiteral, newlineEnter, newlineStrip:
+		default:
+			return fmt.Errorf("invalid newline_mode %q for %s: must be %q, %q, or %q", prog.NewlineMode, prog.Program, newlineLiteral, newlineEnter, newlineStrip)
+		}
+	}
+	return nil
+}
+
+// checkChords returns an error for each chord in the example outputs, macro
+// steps, and intent examples that would fail to type with the configured
+// executor, naming where it is.
+func (c RightHandConfig) checkChords() []error {
+	var errs []error
+	check := func(where, output string) {
+		if _, ok := appleScriptSnippet(output); ok {
+			return
+		}
+		for _, problem := range chordProblems(output, c.Executor) {
+			errs = append(errs, fmt.Errorf("%s: %s", where, problem))
+		}
+	}
+	checkExamples := func(where string, examples []FewShotExample) {
+		for _, example := range examples {
+			check(fmt.Sprintf("%s example %q", where, example.Input), example.Output)
+		}
+	}
+	for _, prog := range c.Programs {
+		checkExamples(prog.Program, prog.Examples)
+	}
+	for name, examples := range c.Profiles {
+		checkExamples("profile "+name, examples)
+	}
+	for name, intent := range c.Intents {
+		checkExamples("intent "+name, intent.Examples)
+	}
+	for name, steps := range c.Macros {
+		for i, step := range steps {
+			check(fmt.Sprintf("macro %q step %d", name, i+1), step)
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// duplicatePrograms returns a warning for each program name or bundle ID that
+// more than one program entry is for. indexPrograms combines the examples of
+// such entries in order, but only the first entry's other settings are used.
+func (c RightHandConfig) duplicatePrograms() []string {
+	var warnings []string
+	byName := make(map[string]int)
+	byBundleID := make(map[string]int)
+	check := func(seen map[string]int, setting, key string, i int) {
+		if key == "" {
+			return
+		}
+		first, ok := seen[key]
+		if !ok {
+			seen[key] = i
+			return
+		}
+		warnings = append(warnings, fmt.Sprintf("program entries %d and %d have the same %s %q; their examples are combined, but only the other settings of entry %d are used",
+			first+1, i+1, setting, key, first+1))
+	}
+	for i, prog := range c.Programs {
+		check(byName, "program", prog.Program, i)
+		check(byBundleID, "bundle_id", prog.BundleID, i)
+	}
+	return warnings
+}
+
+// llmTimeout returns the language model timeout, falling back to DefaultLLMTimeout.
+func (c RightHandConfig) llmTimeout() time.Duration {
+	if c.LLMTimeout <= 0 {
+		return DefaultLLMTimeout
+	}
+	return c.LLMTimeout
+}
+
+// charDelay returns the pause between characters with char_by_char, falling back to DefaultCharDelay.
+func (c RightHandConfig) charDelay() time.Duration {
+	if c.CharDelayMs <= 0 {
+		return DefaultCharDelay
+	}
+	return time.Duration(c.CharDelayMs) * time.Millisecond
+}
+
+// doublePressInterval returns the double-press interval, falling back to DefaultDoublePressInterval.
+func (c RightHandConfig) doublePressInterval() time.Duration {
+	if c.DoublePressInterval <= 0 {
+		return DefaultDoublePressInterval
+	}
+	return c.DoublePressInterval
+}
+
+// appEnabled reports whether RightHand may be activated in the given application.
+func (c RightHandConfig) appEnabled(name, bundleID string) bool {
+	if len(c.EnabledApps) == 0 {
+		return true
+	}
+	for _, app := range c.EnabledApps {
+		if app == name || (bundleID != "" && app == bundleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexPrograms builds the program lookup maps used by programFor.
+// Programs listed more than once are merged: the first entry's settings are
+// kept and the examples of all entries are combined in order. An entry's
+// profile is resolved into the profile's examples, placed before its own.
+func (c *RightHandConfig) indexPrograms() {
+	c.programsByName = make(map[string]*ProgramFewShotExamples)
+	c.programsByBundleID = make(map[string]*ProgramFewShotExamples)
+	index := func(m map[string]*ProgramFewShotExamples, key string, prog ProgramFewShotExamples) {
+		if key == "" {
+			return
+		}
+		if merged, ok := m[key]; ok {
+			merged.Examples = append(merged.Examples, prog.Examples...)
+			return
+		}
+		prog.Examples = append([]FewShotExample(nil), prog.Examples...)
+		m[key] = &prog
+	}
+	for _, prog := range c.Programs {
+		if prog.Profile != "" {
+			prog.Examples = append(append([]FewShotExample(nil), c.Profiles[prog.Profile]...), prog.Examples...)
+		}
+		index(c.programsByName, prog.Program, prog)
+		index(c.programsByBundleID, prog.BundleID, prog)
+	}
+}
+
+// programFor returns the program entry for the given application, or nil if
+// there is none. A match on bundle identifier is preferred over the application name.
+func (c *RightHandConfig) programFor(name, bundleID string) *ProgramFewShotExamples {
+	if name == "" && bundleID == "" {
+		return nil // no frontmost application
+	}
+	if prog, ok := c.programsByBundleID[bundleID]; ok && bundleID != "" {
+		return prog
+	}
+	return c.programsByName[name]
+}
+
+// examplesFor returns the few-shot examples for the given application. If
+// language is set, examples for other languages are left out.
+func (c *RightHandConfig) examplesFor(name, bundleID, language string) []FewShotExample {
+	prog := c.programFor(name, bundleID)
+	if prog == nil {
+		return nil
+	}
+	return filterExamples(prog.Examples, language)
+}
+
+// filterExamples returns the examples for the given language, or all of them
+// if language is empty.
+func filterExamples(examples []FewShotExample, language string) []FewShotExample {
+	if language == "" {
+		return examples
+	}
+	var filtered []FewShotExample
+	for _, example := range examples {
+		if example.Language == "" || example.Language == language {
+			filtered = append(filtered, example)
+		}
+	}
+	return filtered
+}
+
+// targetWindowFor returns the title pattern of the window to type into for the
+// given application, or "" to type into whatever is focused.
+func (c *RightHandConfig) targetWindowFor(name, bundleID string) string {
+	if prog := c.programFor(name, bundleID); prog != nil && prog.TargetWindow != "" {
+		return prog.TargetWindow
+	}
+	return c.TargetWindow
+}
+
+// interpretFor reports whether commands for the given application are
+// interpreted with the language model rather than typed as dictation.
+func (c *RightHandConfig) interpretFor(name, bundleID string) bool {
+	if prog := c.programFor(name, bundleID); prog != nil && prog.Interpret != nil {
+		return *prog.Interpret
+	}
+	return !c.Dictation
+}
+
+// validateOnEcho returns an error if v is not a valid on_echo setting.
+func validateOnEcho(v string) error {
+	switch v {
+	case "", onEchoType, onEchoSkip, onEchoDictate:
+		return nil
+	}
+	return fmt.Errorf("invalid on_echo %q: must be %q, %q, or %q", v, onEchoType, onEchoSkip, onEchoDictate)
+}
+
+// onEchoFor returns the on_echo setting for the given application.
+func (c *RightHandConfig) onEchoFor(name, bundleID string) string {
+	if prog := c.programFor(name, bundleID); prog != nil && prog.OnEcho != "" {
+		return prog.OnEcho
+	}
+	return c.OnEcho
+}
+
+// formatTranscript applies the strip_punctuation and lowercase settings for
+// the given application to a transcription.
+func (c *RightHandConfig) formatTranscript(name, bundleID, text string) string {
+	strip, lower := c.StripPunctuation, c.Lowercase
+	if prog := c.programFor(name, bundleID); prog != nil {
+		if prog.StripPunctuation != nil {
+			strip = *prog.StripPunctuation
+		}
+		if prog.Lowercase != nil {
+			lower = *prog.Lowercase
+		}
+	}
+	if strip {
+		text = strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) && r != '\'' && r != '’' {
+				return ' '
+			}
+			return r
+		}, text)), " ")
+	}
+	if lower {
+		text = strings.ToLower(text)
+	}
+	return text
+}
+
+// lowercaseFirstWordFor reports whether a capitalized first word is
+// lowercased before typing for the given application.
+func (c *RightHandConfig) lowercaseFirstWordFor(name, bundleID string) bool {
+	prog := c.programFor(name, bundleID)
+	return prog != nil && prog.LowercaseFirstWord
+}
+
+// preserveClipboardFor reports whether the clipboard is restored after pasting
+// into the given application, which is the default.
+func (c *RightHandConfig) preserveClipboardFor(name, bundleID string) bool {
+	if prog := c.programFor(name, bundleID); prog != nil && prog.PreserveClipboard != nil {
+		return *prog.PreserveClipboard
+	}
+	return true
+}
+
+// newlineModeFor returns the newline_mode setting for the given application.
+func (c *RightHandConfig) newlineModeFor(name, bundleID string) string {
+	if prog := c.programFor(name, bundleID); prog != nil {
+		return prog.NewlineMode
+	}
+	return ""
+}
+
+// affixesFor returns the text typed before and after output for the given
+// application. Program settings override the global ones.
+func (c *RightHandConfig) affixesFor(name, bundleID string) affixes {
+	a := affixes{prefix: c.OutputPrefix, suffix: c.OutputSuffix}
+	if prog := c.programFor(name, bundleID); prog != nil {
+		if prog.OutputPrefix != "" {
+			a.prefix = prog.OutputPrefix
+		}
+		if prog.OutputSuffix != "" {
+			a.suffix = prog.OutputSuffix
+		}
+	}
+	return a
+}
+
 // RightHandConfig is the configuration file for RightHand.
 type RightHandConfig struct {
 	LLMModel     string                   `json:"llm_model"`
+	LLMModels    map[string]string        `json:"llm_models"`     // spoken name -> model, selectable per command by saying "using <name>, ..."
+	LLMBaseURL   string                   `json:"llm_base_url"`   // optional OpenAI-compatible endpoint, e.g. a proxy or Azure deployment
+	LLMTimeout   time.Duration            `json:"llm_timeout"`    // how long to wait for the language model, e.g. "30s"
+	LLMInterface string                   `json:"llm_interface"`  // "chat" (default) or "completion" for models without a chat API
+	OpenAIAPIKey string                   `json:"openai_api_key"` // used if OPENAI_API_KEY is not set
+	SecretsFile  string                   `json:"secrets_file"`   // YAML file with openai_api_key, used if neither of the above is set
 	WhisperModel string                   `json:"whisper_model"`
+	Language     string                   `json:"language"`    // spoken language, e.g. "de", or "auto" to detect it; requires a multilingual whisper_model
+	Warmup       bool                     `json:"warmup"`      // transcribe silence at startup to speed up the first command
+	PreloadLLM   bool                     `json:"preload_llm"` // connect to the language model API at startup to speed up the first command
+	Quiet        bool                     `json:"quiet"`       // skip the startup banner and instructions
+	MenuBar      bool                     `json:"menu_bar"`    // show the listening state in the menu bar, without a Dock icon
+	NoActivate   bool                     `json:"no_activate"` // don't bring RightHand to the front when it starts
+	WhisperGPU   bool                     `json:"whisper_gpu"` // use GPU (Metal) acceleration for transcription when available
 	Programs     []ProgramFewShotExamples `json:"programs"`
+	UndoOnCancel bool                     `json:"undo_on_cancel"` // undo already-typed text when a command is cancelled
+	LogCommands  bool                     `json:"log_commands"`   // record handled commands for -promote-examples
+	Webhook      *WebhookConfig           `json:"webhook"`        // notified of each executed command
+	TargetWindow string                   `json:"target_window"`  // regexp matching the title of the window to type into
+	EnabledApps  []string                 `json:"enabled_apps"`   // if set, only activate in these apps (names or bundle IDs)
+	CaptureAppAt string                   `json:"capture_app_at"` // when the active app is looked up: "end" (default) of listening, or "start"
+
+	Context string `json:"context"` // what you are working on, e.g. "a Go web service", given to the language model with every command
+
+	Replacements []Replacement `json:"replacements"` // regexp substitutions applied in order to the language model's output
+
+	WhisperModelPath string  `json:"whisper_model_path"` // model file to use instead of downloading whisper_model
+	MinConfidence    float32 `json:"min_confidence"`     // ignore transcriptions whose average token probability is below this, from 0 to 1
+
+	ShowWords bool `json:"show_words"` // print each word with its time in the recording as whisper recognizes it
+
+	Executor       string `json:"executor"`         // how input is performed: "robotgo" (default), "clipboard", "log", or "applescript"
+	PasteThreshold int    `json:"paste_threshold"`  // paste text longer than this many characters from the clipboard instead of typing it
+	PasteboardType string `json:"pasteboard_type"`  // how pasted text is put on the clipboard: "plain" (default) or "rtf"
+	KeepCodeFences bool   `json:"keep_code_fences"` // type Markdown code fences around the model's output instead of stripping them
+	JSONActions    bool   `json:"json_actions"`     // ask the model for a JSON array of actions instead of {...} chord text
+	OutputPrefix   string `json:"output_prefix"`    // typed as is before each typed output, e.g. "> "
+	OutputSuffix   string `json:"output_suffix"`    // typed as is after each typed output
+	OutputTarget   string `json:"output_target"`    // where output goes: "type" (default) into the active app, "review" to edit it first, or "shell" to output_command
+	OutputCommand  string `json:"output_command"`   // with output_target: shell, run with sh -c with the output on stdin, e.g. "cat >> ~/notes.md"
+
+	PreTypeDelayMs int  `json:"pre_type_delay_ms"` // wait this many milliseconds before typing, to let focus changes settle
+	VerifyFocus    bool `json:"verify_focus"`      // warn if the frontmost app changes while typing
+	RefocusApp     bool `json:"refocus_app"`       // if RightHand itself is frontmost when typing, activate the app that was frontmost before it
+	CharByChar     bool `json:"char_by_char"`      // type text one character at a time, for apps that can't keep up
+	CharDelayMs    int  `json:"char_delay_ms"`     // pause between characters with char_by_char
+	EchoTyped      bool `json:"echo_typed"`        // print each stretch of text and each key press as it is typed
+
+	StripPunctuation bool `json:"strip_punctuation"` // remove punctuation from transcriptions, except apostrophes
+	Lowercase        bool `json:"lowercase"`         // lowercase transcriptions
+
+	Dictation     bool              `json:"dictation"`      // type what was said instead of interpreting it with the language model
+	DictationKeys map[string]string `json:"dictation_keys"` // spoken phrase -> key pressed in dictation mode, e.g. "new line": "enter"
+
+	OnEcho string `json:"on_echo"` // when the language model returns what was said unchanged: "type" it (default), "skip" it, or "dictate" it
+
+	KeyMap map[string]string `json:"key_map"` // name used in chords -> robotgo key name, merged over the built-in names, e.g. "F13": "f13"
+
+	ChordSeparators string `json:"chord_separators"` // characters, one of which is dropped after a chord (default space, semicolon, comma, period, and newline)
+
+	Profiles map[string][]FewShotExample `json:"profiles"` // name -> examples shared by the program entries that reference it
+
+	Macros         map[string][]string `json:"macros"`           // spoken name -> outputs typed in order, bypassing the language model
+	MacroStepDelay time.Duration       `json:"macro_step_delay"` // pause between macro steps, e.g. "200ms"
+
+	Templates []Template `json:"templates"` // spoken commands with arguments, typed without asking the language model
+
+	Disabled         bool `json:"disabled"`          // start with activation chords ignored
+	RememberDisabled bool `json:"remember_disabled"` // save the enabled/disabled state when it is toggled
+
+	EmergencyStop string `json:"emergency_stop"` // hotkey that stops all input and disables RightHand, e.g. "command+shift+escape"
+	ToggleHotkey  string `json:"toggle_hotkey"`  // hotkey that disables or enables RightHand (default "control+shift+f11")
+	CancelHotkey  string `json:"cancel_hotkey"`  // hotkey that cancels the command in progress (default "control+shift+escape")
+
+	MaxCommandsPerMinute int `json:"max_commands_per_minute"` // drop commands beyond this many a minute, as a backstop against runaway input
+	RateLimitBurst       int `json:"rate_limit_burst"`        // commands allowed in quick succession with max_commands_per_minute (default 3)
+
+	MaxOutputChars int `json:"max_output_chars"` // truncate the language model's output to this many characters before typing it
+
+	Intents map[string]Intent `json:"intents"` // name -> hotkey, prompt, and examples used regardless of the active app
+
+	RetryHotkey       string `json:"retry_hotkey"`        // hotkey that re-transcribes the last utterance with retry_whisper_model, e.g. "control+option+r"
+	RetryWhisperModel string `json:"retry_whisper_model"` // whisper model used by retry_hotkey, such as a larger one
+
+	ConfirmHotkey        string `json:"confirm_hotkey"`         // hotkey that saves the last command as an example for its app, e.g. "control+option+y"
+	MaxConfirmedExamples int    `json:"max_confirmed_examples"` // examples for an app beyond which confirm_hotkey saves no more (default 50)
+
+	FallbackWhisperModel string `json:"fallback_whisper_model"` // smaller whisper model used for a while when transcription is slow
+	SlowTranscriptionMs  int    `json:"slow_transcription_ms"`  // average transcription time that counts as slow (default 3000)
+
+	EmptyRetries       int `json:"empty_retries"`         // when nothing is transcribed, ask to try again up to this many times in a row
+	EmptyRetryListenMs int `json:"empty_retry_listen_ms"` // with empty_retries, listen again right away for this many milliseconds
+
+	ActivationKeyCodes []int `json:"activation_key_codes"` // virtual key codes that toggle listening like the activation chord, such as a footswitch's, e.g. [105] for F13
+
+	DoublePress         bool          `json:"double_press"`          // require pressing the activation chord twice to start listening
+	DoublePressInterval time.Duration `json:"double_press_interval"` // maximum time between the two presses, e.g. "500ms"
+	CooldownMs          int           `json:"cooldown_ms"`           // ignore activation for this many milliseconds after a command
+	CoalesceWindow      time.Duration `json:"coalesce_window"`       // merge utterances started within this long after the previous one, e.g. "1.5s"
+	PreRollMs           int           `json:"pre_roll_ms"`           // keep recording between commands and start each with this many milliseconds from before the chord
+	SupersedeInFlight   bool          `json:"supersede_in_flight"`   // starting a new command cancels those not yet typed, so only the latest runs
+
+	CrashRecovery bool `json:"crash_recovery"` // save audio while listening so -recover can transcribe it after a crash
+
+	LogAudioStats bool `json:"log_audio_stats"` // write the duration, level, and silence of each command's audio to righthand.log
+
+	DumpWAVFormat string `json:"dump_wav_format"` // encoding of the -dump-wav file: "pcm24" (default), "pcm16", or "float32"
 
 	DumpWAVFile bool
+	NoAudio     bool `json:"-"` // skip voice recognition initialization
+	Verbose     bool `json:"-"` // print diagnostic details
+	PrintPrompt bool `json:"-"` // print the messages sent to the language model
+	TUI         bool `json:"-"` // show a live status panel instead of scrolling status output
+	Explain     bool `json:"-"` // print which macro, program entry, and examples were used for each command
+	Training    bool `json:"-"` // save each utterance with a correction of its output to the training dataset
+	QuietFlag   bool `json:"-"` // set by -quiet, which skips the banner for one run without changing quiet
+
+	programsByName     map[string]*ProgramFewShotExamples // built by indexPrograms
+	programsByBundleID map[string]*ProgramFewShotExamples // built by indexPrograms
+	replacePatterns    []*regexp.Regexp                   // built by compileReplacements
+	templates          []compiledTemplate                 // built by compileTemplates
 }
 
 // ProgramFewShotExamples is a program with a list of few-shot examples.
 type ProgramFewShotExamples struct {
 	Program  string           `json:"program"`
+	BundleID string           `json:"bundle_id,omitempty"` // e.g. "com.googlecode.iterm2"; takes precedence over Program
 	Examples []FewShotExample `json:"examples"`
+	Profile  string           `json:"profile,omitempty"` // name of an entry in profiles whose examples are used before these
+
+	TargetWindow string `json:"target_window,omitempty"` // overrides the global target_window
+	OutputPrefix string `json:"output_prefix,omitempty"` // overrides the global output_prefix
+	OutputSuffix string `json:"output_suffix,omitempty"` // overrides the global output_suffix
+
+	Interpret *bool `json:"interpret,omitempty"` // interpret commands with the language model (true) or type what was said (false); overrides dictation
+
+	StripPunctuation   *bool `json:"strip_punctuation,omitempty"`    // overrides the global strip_punctuation
+	Lowercase          *bool `json:"lowercase,omitempty"`            // overrides the global lowercase
+	LowercaseFirstWord bool  `json:"lowercase_first_word,omitempty"` // lowercase a capitalized first word before typing, e.g. "Cd ~" for shells
+
+	OnEcho string `json:"on_echo,omitempty"` // overrides the global on_echo
+
+	PreserveClipboard *bool `json:"preserve_clipboard,omitempty"` // restore the clipboard after pasting (default true); false leaves the pasted text on it
+
+	NewlineMode string `json:"newline_mode,omitempty"` // how newlines in typed text are entered: "literal" (default), "enter" to press Enter, or "strip" to drop them
 }
 
 // FewShotExample is a few-shot example.
 type FewShotExample struct {
 	Input  string `json:"input"`
 	Output string `json:"output"`
+
+	Language string `json:"language,omitempty"` // only used for utterances in this language, e.g. "de"
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultDictationKeys maps spoken phrases to the keys they press in dictation mode.
+var defaultDictationKeys = map[string]string{
+	"new line": "enter",
+	"newline":  "enter",
+	"tab":      "tab",
+}
+
+// dictationKeys returns the phrase to key map for dictation mode.
+func (c RightHandConfig) dictationKeys() map[string]string {
+	if c.DictationKeys == nil {
+		return defaultDictationKeys
+	}
+	return c.DictationKeys
+}
+
+// dictationPattern returns a pattern matching any of the phrases in keys as
+// whole words, along with the punctuation and spacing transcription adds around them.
+func dictationPattern(keys map[string]string) *regexp.Regexp {
+	phrases := make([]string, 0, len(keys))
+	for phrase := range keys {
+		phrases = append(phrases, regexp.QuoteMeta(strings.ToLower(phrase)))
+	}
+	// prefer the longest phrase, e.g. "new line" over "line"
+	sort.Slice(phrases, func(i, j int) bool { return len(phrases[i]) > len(phrases[j]) })
+	return regexp.MustCompile(`(?i)[ ,]*\b(` + strings.Join(phrases, "|") + `)\b[.,!?]?[ ]*`)
+}
+
+// typeDictation types text literally, except that spoken phrases in keys
+// (such as "new line") press the corresponding key instead. Unlike
+// simulateTyping, {...} chords are not interpreted.
+func typeDictation(ctx context.Context, exec Executor, text string, keys map[string]string) error {
+	if len(keys) == 0 {
+		return exec.Type(text)
+	}
+	lower := make(map[string]string, len(keys))
+	for phrase, key := range keys {
+		lower[strings.ToLower(phrase)] = key
+	}
+
+	typed := 0
+	lastIndex := 0
+	for _, match := range dictationPattern(keys).FindAllStringSubmatchIndex(text, -1) {
+		if err := ctx.Err(); err != nil {
+			return &typingCancelledError{err: err, typed: typed}
+		}
+		if lastIndex != match[0] {
+			if err := exec.Type(text[lastIndex:match[0]]); err != nil {
+				return err
+			}
+			typed++
+		}
+		if err := exec.KeyTap(lower[strings.ToLower(text[match[2]:match[3]])]); err != nil {
+			return err
+		}
+		lastIndex = match[1]
+	}
+	if lastIndex < len(text) {
+		if err := ctx.Err(); err != nil {
+			return &typingCancelledError{err: err, typed: typed}
+		}
+		return exec.Type(text[lastIndex:])
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/progrium/macdriver/cocoa"
+)
+
+// hotkey is a key pressed while holding modifiers.
+type hotkey struct {
+	modifiers int64 // NSEventModifierFlag bits that must be held
+	keyCode   int64 // virtual key code
+}
+
+// letterKeyCodes maps letters and digits to the macOS virtual key codes of
+// their positions on a US keyboard, for hotkeys.
+var letterKeyCodes = map[string]int{
+	"a": 0, "s": 1, "d": 2, "f": 3, "h": 4, "g": 5, "z": 6, "x": 7, "c": 8, "v": 9,
+	"b": 11, "q": 12, "w": 13, "e": 14, "r": 15, "y": 16, "t": 17, "o": 31, "u": 32,
+	"i": 34, "p": 35, "l": 37, "j": 38, "k": 40, "n": 45, "m": 46,
+	"1": 18, "2": 19, "3": 20, "4": 21, "6": 22, "5": 23, "9": 25, "7": 26, "8": 28, "0": 29,
+}
+
+// hotkeyKeyCode returns the virtual key code of a hotkey's key, which is one
+// of virtualKeyCodes or letterKeyCodes.
+func hotkeyKeyCode(key string) (int, bool) {
+	if code, ok := virtualKeyCodes[key]; ok {
+		return code, true
+	}
+	code, ok := letterKeyCodes[key]
+	return code, ok
+}
+
+// parseHotkey parses a hotkey such as "command+shift+escape" or
+// "control+option+r". The key must be one of virtualKeyCodes or letterKeyCodes.
+func parseHotkey(s string) (hotkey, error) {
+	parts := strings.Split(strings.ToLower(strings.ReplaceAll(s, " ", "")), "+")
+	code, ok := hotkeyKeyCode(parts[len(parts)-1])
+	if !ok {
+		return hotkey{}, fmt.Errorf("unsupported key %q", parts[len(parts)-1])
+	}
+	h := hotkey{keyCode: int64(code)}
+	for _, m := range parts[:len(parts)-1] {
+		switch m {
+		case "command", "cmd":
+			h.modifiers |= NSEventModifierFlagCommand
+		case "option", "alt":
+			h.modifiers |= NSEventModifierFlagOption
+		case "control", "ctrl":
+			h.modifiers |= NSEventModifierFlagControl
+		case "shift":
+			h.modifiers |= NSEventModifierFlagShift
+		default:
+			return hotkey{}, fmt.Errorf("unknown modifier %q", m)
+		}
+	}
+	return h, nil
+}
+
+// hotkeyModifierMask is the modifier flags that hotkeys can include. Other
+// bits of an event's modifier flags, such as Caps Lock, are ignored.
+const hotkeyModifierMask = NSEventModifierFlagControl | NSEventModifierFlagOption | NSEventModifierFlagShift | NSEventModifierFlagCommand
+
+// matches reports whether the key event e is this hotkey.
+func (h hotkey) matches(e cocoa.NSEvent) bool {
+	return h.matchesKey(e.Get("keyCode").Int(), e.Get("modifierFlags").Int())
+}
+
+// matchesKey reports whether a press of keyCode with modifierFlags held is
+// this hotkey. The modifiers held must be exactly the hotkey's, so that
+// control+f1 doesn't also fire on control+option+f1.
+func (h hotkey) matchesKey(keyCode, modifierFlags int64) bool {
+	return keyCode == h.keyCode && modifierFlags&hotkeyModifierMask == h.modifiers
+}
+
+// checkHotkeyClashes returns an error if two settings, including intent
+// hotkeys, use the same hotkey, since a press would then trigger both. The
+// emergency stop, toggle, and cancel hotkeys are checked with their defaults
+// if unset. The hotkeys must already be valid.
+func (c RightHandConfig) checkHotkeyClashes() error {
+	type binding struct{ setting, hotkey string }
+	bindings := []binding{
+		{"emergency_stop", c.EmergencyStop},
+		{"toggle_hotkey", c.toggleHotkeyName()},
+		{"cancel_hotkey", c.cancelHotkeyName()},
+		{"retry_hotkey", c.RetryHotkey},
+		{"confirm_hotkey", c.ConfirmHotkey},
+	}
+	if bindings[0].hotkey == "" {
+		bindings[0].hotkey = DefaultEmergencyStop
+	}
+	for _, name := range c.intentNames() {
+		bindings = append(bindings, binding{fmt.Sprintf("the hotkey of intent %q", name), c.Intents[name].Hotkey})
+	}
+	bound := make(map[hotkey]string)
+	for _, b := range bindings {
+		if b.hotkey == "" {
+			continue
+		}
+		h, err := parseHotkey(b.hotkey)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", b.setting, err)
+		}
+		if other, ok := bound[h]; ok {
+			return fmt.Errorf("%s and %s are both %q; each hotkey can do only one thing", other, b.setting, b.hotkey)
+		}
+		bound[h] = b.setting
+	}
+	return nil
+}
+
+// emergencyStop returns the emergency stop hotkey, falling back to DefaultEmergencyStop.
+func (c RightHandConfig) emergencyStop() hotkey {
+	h, err := parseHotkey(c.EmergencyStop)
+	if c.EmergencyStop == "" || err != nil {
+		h, _ = parseHotkey(DefaultEmergencyStop)
+	}
+	return h
+}
+
+// emergencyStop cancels all commands in flight, stops listening, drops the
+// utterances not yet handled, releases any modifier keys left held down, and
+// disables RightHand until it is re-enabled.
+func (app *App) emergencyStop() {
+	app.disabled.Store(true) // first, so no utterance starts being handled meanwhile
+	app.haltListening()
+	app.cancelAllCommands()
+	for _, key := range []string{"command", "shift", "alt", "ctrl"} {
+		if err := robotgo.KeyUp(key); err != nil {
+			log.Printf("Error releasing %s: %v", key, err)
+		}
+	}
+	app.showIdle()
+	fmt.Printf("🚨 Emergency stop: input stopped and RightHand disabled (%s to enable)\n", app.config().toggleHotkeyName())
+	log.Printf("Emergency stop")
+}
@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+func TestParseHotkey(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    hotkey
+		wantErr bool
+	}{
+		// documented examples
+		{in: DefaultEmergencyStop, want: hotkey{modifiers: NSEventModifierFlagCommand | NSEventModifierFlagShift, keyCode: 53}},
+		{in: DefaultToggleHotkey, want: hotkey{modifiers: NSEventModifierFlagControl | NSEventModifierFlagShift, keyCode: 103}},
+		{in: DefaultCancelHotkey, want: hotkey{modifiers: NSEventModifierFlagControl | NSEventModifierFlagShift, keyCode: 53}},
+		{in: "command+shift+f10", want: hotkey{modifiers: NSEventModifierFlagCommand | NSEventModifierFlagShift, keyCode: 109}},
+		{in: "control+shift+f12", want: hotkey{modifiers: NSEventModifierFlagControl | NSEventModifierFlagShift, keyCode: 111}},
+		{in: "control+option+r", want: hotkey{modifiers: NSEventModifierFlagControl | NSEventModifierFlagOption, keyCode: 15}},
+		{in: "control+option+y", want: hotkey{modifiers: NSEventModifierFlagControl | NSEventModifierFlagOption, keyCode: 16}},
+		{in: "control+option+f1", want: hotkey{modifiers: NSEventModifierFlagControl | NSEventModifierFlagOption, keyCode: 122}},
+
+		{in: "Cmd + Alt + 1", want: hotkey{modifiers: NSEventModifierFlagCommand | NSEventModifierFlagOption, keyCode: 18}},
+		{in: "escape", want: hotkey{keyCode: 53}},
+		{in: "control+option+rr", wantErr: true},
+		{in: "hyper+r", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHotkey(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHotkey(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseHotkey(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHotkeyMatchesKey(t *testing.T) {
+	const capsLock = 1 << 16
+	tests := []struct {
+		hotkey        string
+		keyCode       int64
+		modifierFlags int64
+		want          bool
+	}{
+		{"command+shift+escape", 53, NSEventModifierFlagCommand | NSEventModifierFlagShift, true},
+		{"command+shift+escape", 53, NSEventModifierFlagCommand | NSEventModifierFlagShift | capsLock, true},
+		{"command+shift+escape", 53, NSEventModifierFlagCommand, false},
+		{"command+shift+escape", 122, NSEventModifierFlagCommand | NSEventModifierFlagShift, false},
+		// extra modifiers make it another hotkey
+		{"command+shift+escape", 53, NSEventModifierFlagControl | NSEventModifierFlagCommand | NSEventModifierFlagShift, false},
+		{"control+shift+escape", 53, NSEventModifierFlagControl | NSEventModifierFlagCommand | NSEventModifierFlagShift, false},
+		{"control+f1", 122, NSEventModifierFlagControl | NSEventModifierFlagOption, false},
+		{"control+option+f1", 122, NSEventModifierFlagControl | NSEventModifierFlagOption, true},
+		{"f12", 111, 0, true},
+		{"f12", 111, NSEventModifierFlagShift, false},
+	}
+	for _, tt := range tests {
+		h, err := parseHotkey(tt.hotkey)
+		if err != nil {
+			t.Fatalf("parseHotkey(%q) error: %v", tt.hotkey, err)
+		}
+		if got := h.matchesKey(tt.keyCode, tt.modifierFlags); got != tt.want {
+			t.Errorf("%q matchesKey(%d, %#x) = %v, want %v", tt.hotkey, tt.keyCode, tt.modifierFlags, got, tt.want)
+		}
+	}
+}
+
+func TestCheckHotkeyClashes(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RightHandConfig
+		wantErr bool
+	}{
+		{name: "defaults", cfg: RightHandConfig{}},
+		{name: "distinct", cfg: RightHandConfig{
+			RetryHotkey:   "control+option+r",
+			ConfirmHotkey: "control+option+y",
+			Intents: map[string]Intent{
+				"shell": {Hotkey: "control+f1"},
+				"prose": {Hotkey: "control+option+f1"},
+			},
+		}},
+		{name: "intents share a hotkey", cfg: RightHandConfig{Intents: map[string]Intent{
+			"shell": {Hotkey: "control+option+f1"},
+			"prose": {Hotkey: "ctrl+alt+f1"},
+		}}, wantErr: true},
+		{name: "intent uses the default emergency stop", cfg: RightHandConfig{Intents: map[string]Intent{
+			"shell": {Hotkey: DefaultEmergencyStop},
+		}}, wantErr: true},
+		{name: "cancel_hotkey is the emergency stop", cfg: RightHandConfig{CancelHotkey: "command+shift+escape"}, wantErr: true},
+		{name: "toggle_hotkey moved off an intent's hotkey", cfg: RightHandConfig{
+			ToggleHotkey: "control+option+f2",
+			Intents:      map[string]Intent{"shell": {Hotkey: DefaultToggleHotkey}},
+		}},
+		{name: "retry and confirm share a hotkey", cfg: RightHandConfig{RetryHotkey: "control+option+r", ConfirmHotkey: "control+option+r"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.checkHotkeyClashes(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkHotkeyClashes() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "errors"
+
+// Errors returned by newApp, wrapped with the underlying cause.
+// Use errors.Is to tell them apart.
+var (
+	// ErrInvalidConfig indicates the configuration failed validation.
+	ErrInvalidConfig = errors.New("invalid config")
+	// ErrLogFile indicates the log file could not be created.
+	ErrLogFile = errors.New("could not create log file")
+	// ErrNoInputDevice indicates there is no audio input device to listen with.
+	ErrNoInputDevice = errors.New("no audio input device")
+	// ErrWhisperInit indicates voice recognition could not be initialized.
+	ErrWhisperInit = errors.New("could not initialize voice recognition")
+	// ErrLLMInit indicates the language model could not be initialized.
+	ErrLLMInit = errors.New("could not initialize language model")
+)
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/progrium/macdriver/cocoa"
+)
+
+// Executors selectable with the executor setting.
+const (
+	executorRobotgo     = "robotgo"
+	executorClipboard   = "clipboard"
+	executorLog         = "log"
+	executorAppleScript = "applescript"
+)
+
+// Pasteboard types selectable with the pasteboard_type setting.
+const (
+	pasteboardPlain = "plain"
+	pasteboardRTF   = "rtf"
+)
+
+// Executor performs the keyboard input for a command.
+type Executor interface {
+	// Type types text literally.
+	Type(text string) error
+	// KeyTap presses key while holding modifiers. Keys and modifiers use
+	// robotgo names, such as "t", "enter", "command", and "alt".
+	KeyTap(key string, modifiers ...string) error
+}
+
+// newExecutor returns the named executor; "" selects robotgo. Text pasted
+// from the clipboard is put on it as pasteboardType.
+func newExecutor(name, pasteboardType string) (Executor, error) {
+	switch pasteboardType {
+	case "", pasteboardPlain, pasteboardRTF:
+	default:
+		return nil, fmt.Errorf("unknown pasteboard_type %q", pasteboardType)
+	}
+	switch name {
+	case "", executorRobotgo:
+		return robotgoExecutor{}, nil
+	case executorClipboard:
+		return clipboardExecutor{pasteboardType: pasteboardType}, nil
+	case executorLog:
+		return logExecutor{}, nil
+	case executorAppleScript:
+		return appleScriptExecutor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown executor %q", name)
+	}
+}
+
+// robotgoExecutor synthesizes key presses with robotgo.
+type robotgoExecutor struct{}
+
+func (robotgoExecutor) Type(text string) error {
+	robotgo.TypeStr(text)
+	return nil
+}
+
+func (robotgoExecutor) KeyTap(key string, modifiers ...string) error {
+	args := make([]any, len(modifiers))
+	for i, m := range modifiers {
+		args[i] = m
+	}
+	keyTapWithModifiers(args, key)
+	return nil
+}
+
+// clipboardExecutor types text by pasting it from the clipboard, restoring
+// the previous clipboard contents afterwards. Key presses use robotgo.
+type clipboardExecutor struct {
+	robotgoExecutor
+	pasteboardType string // pasteboardPlain (default) or pasteboardRTF
+	noRestore      bool   // leave the pasted text on the clipboard, for preserve_clipboard: false
+}
+
+func (e clipboardExecutor) Type(text string) error {
+	var saved string
+	if !e.noRestore {
+		var err error
+		if saved, err = robotgo.ReadAll(); err != nil {
+			return err
+		}
+	}
+	if e.pasteboardType == pasteboardRTF {
+		// rich text editors take the RTF; others fall back to the plain text
+		pb := cocoa.NSPasteboard_GeneralPasteboard()
+		pb.ClearContents()
+		pb.SetStringForType(rtfDocument(text), cocoa.NSPasteboardTypeRTF)
+		pb.SetStringForType(text, cocoa.NSPasteboardTypeString)
+	} else if err := robotgo.WriteAll(text); err != nil {
+		return err
+	}
+	e.KeyTap("v", "command")
+	if e.noRestore {
+		return nil
+	}
+	time.Sleep(100 * time.Millisecond) // let the paste complete before restoring
+	return robotgo.WriteAll(saved)
+}
+
+// pasteLongText types text longer than threshold characters by pasting it
+// from the clipboard, and everything else with Executor.
+type pasteLongText struct {
+	Executor
+	threshold      int
+	pasteboardType string
+	noRestore      bool
+}
+
+func (e pasteLongText) Type(text string) error {
+	if utf8.RuneCountInString(text) > e.threshold {
+		return clipboardExecutor{pasteboardType: e.pasteboardType, noRestore: e.noRestore}.Type(text)
+	}
+	return e.Executor.Type(text)
+}
+
+// charByChar types text one character at a time with Executor, pausing
+// between characters, for apps that drop input typed all at once.
+type charByChar struct {
+	Executor
+	delay time.Duration
+}
+
+func (e charByChar) Type(text string) error {
+	for i, r := range text {
+		if i > 0 {
+			time.Sleep(e.delay)
+		}
+		if err := e.Executor.Type(string(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// robotgoKeys are the names of the keys robotgo presses other than
+// characters, as in {Command}+pageup.
+var robotgoKeys = map[string]bool{
+	"backspace": true, "delete": true, "enter": true, "tab": true, "esc": true, "escape": true,
+	"up": true, "down": true, "right": true, "left": true,
+	"home": true, "end": true, "pageup": true, "pagedown": true,
+	"space": true, "insert": true, "menu": true, "capslock": true, "print": true, "printscreen": true,
+	"f1": true, "f2": true, "f3": true, "f4": true, "f5": true, "f6": true, "f7": true, "f8": true,
+	"f9": true, "f10": true, "f11": true, "f12": true, "f13": true, "f14": true, "f15": true, "f16": true,
+	"f17": true, "f18": true, "f19": true, "f20": true, "f21": true, "f22": true, "f23": true, "f24": true,
+	"num0": true, "num1": true, "num2": true, "num3": true, "num4": true,
+	"num5": true, "num6": true, "num7": true, "num8": true, "num9": true,
+}
+
+// executorHasKey reports whether the named executor can press the key with
+// the given multi-character name, such as "pageup". The applescript executor
+// presses only virtualKeyCodes; the others press keys with robotgo.
+func executorHasKey(executor, key string) bool {
+	key = strings.ToLower(key)
+	if executor == executorAppleScript {
+		_, ok := virtualKeyCodes[key]
+		return ok
+	}
+	return robotgoKeys[key]
+}
+
+// rtfDocument returns text as a plain RTF document.
+func rtfDocument(text string) string {
+	var b strings.Builder
+	b.WriteString(`{\rtf1\ansi\deff0 `)
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '{' || r == '}':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString("\\par\n")
+		case r == '\t':
+			b.WriteString(`\tab `)
+		case r < 0x80:
+			b.WriteRune(r)
+		default:
+			// \uN takes a signed 16-bit value, so characters beyond the BMP are
+			// written as surrogate pairs; "?" is the fallback for old readers
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%d?`, int16(u))
+			}
+		}
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// logExecutor prints input instead of performing it, for trying out commands.
+type logExecutor struct{}
+
+func (logExecutor) Type(text string) error {
+	fmt.Printf("⌨️  type %q\n", text)
+	return nil
+}
+
+func (logExecutor) KeyTap(key string, modifiers ...string) error {
+	fmt.Printf("⌨️  key %s\n", strings.Join(append(modifiers, key), "+"))
+	return nil
+}
+
+// echoTyped prints input once Executor has performed it, for echo_typed.
+type echoTyped struct {
+	Executor
+}
+
+func (e echoTyped) Type(text string) error {
+	if err := e.Executor.Type(text); err != nil {
+		return err
+	}
+	fmt.Printf("⌨️  typed %q\n", text)
+	return nil
+}
+
+func (e echoTyped) KeyTap(key string, modifiers ...string) error {
+	if err := e.Executor.KeyTap(key, modifiers...); err != nil {
+		return err
+	}
+	fmt.Printf("⌨️  pressed %s\n", strings.Join(append(modifiers, key), "+"))
+	return nil
+}
+
+// appleScriptExecutor performs input with System Events via osascript.
+type appleScriptExecutor struct{}
+
+// virtualKeyCodes maps robotgo key names to macOS virtual key codes for keys
+// that AppleScript can't send with keystroke.
+var virtualKeyCodes = map[string]int{
+	"enter":     36,
+	"tab":       48,
+	"space":     49,
+	"backspace": 51,
+	"delete":    117,
+	"escape":    53,
+	"left":      123,
+	"right":     124,
+	"down":      125,
+	"up":        126,
+	"f1":        122,
+	"f2":        120,
+	"f3":        99,
+	"f4":        118,
+	"f5":        96,
+	"f6":        97,
+	"f7":        98,
+	"f8":        100,
+	"f9":        101,
+	"f10":       109,
+	"f11":       103,
+	"f12":       111,
+}
+
+func (appleScriptExecutor) Type(text string) error {
+	return runAppleScript(fmt.Sprintf(`tell application "System Events" to keystroke %s`, appleScriptString(text)))
+}
+
+func (appleScriptExecutor) KeyTap(key string, modifiers ...string) error {
+	press := "keystroke " + appleScriptString(key)
+	if code, ok := virtualKeyCodes[key]; ok {
+		press = fmt.Sprintf("key code %d", code)
+	}
+	if len(modifiers) > 0 {
+		downs := make([]string, len(modifiers))
+		for i, m := range modifiers {
+			switch m {
+			case "alt":
+				m = "option"
+			case "ctrl":
+				m = "control"
+			}
+			downs[i] = m + " down"
+		}
+		press += " using {" + strings.Join(downs, ", ") + "}"
+	}
+	return runAppleScript(`tell application "System Events" to ` + press)
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// appleScriptPrefix marks an output as an AppleScript snippet to run rather than type.
+const appleScriptPrefix = "#!osascript"
+
+// appleScriptSnippet reports whether output is an AppleScript snippet and, if so,
+// returns the script that follows the prefix line.
+func appleScriptSnippet(output string) (string, bool) {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, appleScriptPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(output, appleScriptPrefix)), true
+}
+
+// runAppleScript runs script with osascript.
+func runAppleScript(script string) error {
+	return runAppleScriptContext(context.Background(), script)
+}
+
+// runAppleScriptContext runs script with osascript, killing it if ctx is cancelled.
+func runAppleScriptContext(ctx context.Context, script string) error {
+	out, err := exec.CommandContext(ctx, "osascript", "-e", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("osascript: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// explainf prints a step of how a command was handled when running with
+// -explain or -verbose. Messages are always logged.
+func (app *App) explainf(format string, args ...any) {
+	log.Printf(format, args...)
+	if cfg := app.config(); cfg.Explain || cfg.Verbose {
+		fmt.Printf("🧭 "+format+"\n", args...)
+	}
+}
+
+// explainProgram describes which program entry, if any, applies to the given application.
+func (c *RightHandConfig) explainProgram(name, bundleID string) string {
+	if name == "" && bundleID == "" {
+		return "no frontmost application, so no program entry"
+	}
+	if prog, ok := c.programsByBundleID[bundleID]; ok && bundleID != "" {
+		return fmt.Sprintf("program entry %q matched by bundle ID %s", prog.Program, bundleID)
+	}
+	if _, ok := c.programsByName[name]; ok {
+		return fmt.Sprintf("program entry %q matched by name", name)
+	}
+	if bundleID != "" {
+		return fmt.Sprintf("no program entry for %s (%s)", name, bundleID)
+	}
+	return fmt.Sprintf("no program entry for %s", name)
+}
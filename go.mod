@@ -7,6 +7,7 @@ toolchain go1.23.3
 require (
 	github.com/go-vgo/robotgo v0.110.5
 	github.com/goccy/go-yaml v1.11.0
+	github.com/gordonklaus/portaudio v0.0.0-20221027163845-7c3b689db3cc
 	github.com/progrium/macdriver v0.4.1-0.20230706190053-7e5bd0a70b46
 	github.com/tmc/audioutil v0.0.0-20230707005244-54efdb41c235
 	github.com/tmc/langchaingo v0.0.0-20230701162323-81dcfa6b690d
@@ -26,7 +27,6 @@ require (
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
-	github.com/gordonklaus/portaudio v0.0.0-20221027163845-7c3b689db3cc // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
 	github.com/kbinani/screenshot v0.0.0-20240820160931-a8a2c5d0e191 // indirect
 	github.com/lufia/plan9stats v0.0.0-20240909124753-873cd0166683 // indirect
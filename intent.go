@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/progrium/macdriver/cocoa"
+)
+
+// Intent is a kind of command bound to its own hotkey, such as "shell" or
+// "prose". Commands started with the hotkey use the intent's prompt and
+// examples regardless of the active application.
+type Intent struct {
+	Hotkey   string           `json:"hotkey"` // toggles listening for this intent, e.g. "control+option+f1"
+	Prompt   string           `json:"prompt"` // system prompt used instead of the default
+	Examples []FewShotExample `json:"examples"`
+
+	WhisperModel string `json:"whisper_model"` // whisper model used instead of the default, e.g. a fast one for short commands
+}
+
+// intentFor returns the named intent, or nil if name is empty or unknown.
+func (c *RightHandConfig) intentFor(name string) *Intent {
+	intent, ok := c.Intents[name]
+	if name == "" || !ok {
+		return nil
+	}
+	return &intent
+}
+
+// intentWhisperModel returns the whisper model for commands with the named
+// intent, or "" to use the configured one.
+func (c *RightHandConfig) intentWhisperModel(name string) string {
+	intent := c.intentFor(name)
+	if intent == nil || intent.WhisperModel == c.WhisperModel && c.WhisperModelPath == "" {
+		return ""
+	}
+	return intent.WhisperModel
+}
+
+// intentNames returns the names of the intents in sorted order.
+func (c *RightHandConfig) intentNames() []string {
+	names := make([]string, 0, len(c.Intents))
+	for name := range c.Intents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// intentHotkey returns the name of the intent whose hotkey is the key event
+// e. validate rejects intents that share a hotkey, but the intents are still
+// checked in sorted order so the result never depends on map order.
+func (c *RightHandConfig) intentHotkey(e cocoa.NSEvent) (string, bool) {
+	for _, name := range c.intentNames() {
+		h, err := parseHotkey(c.Intents[name].Hotkey)
+		if err == nil && h.matches(e) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// systemPrompt returns the system prompt for commands with the intent.
+func (i *Intent) systemPrompt(activeApp string) string {
+	if i.Prompt == "" {
+		return fmt.Sprintf(systemPrompt, activeApp)
+	}
+	return i.Prompt
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/progrium/macdriver/cocoa"
+	"github.com/progrium/macdriver/objc"
+)
+
+// Settings that -save-hotkey-as can write a learned key to.
+const (
+	learnRetryHotkey   = "retry_hotkey"
+	learnConfirmHotkey = "confirm_hotkey"
+	learnEmergencyStop = "emergency_stop"
+	learnToggleHotkey  = "toggle_hotkey"
+	learnCancelHotkey  = "cancel_hotkey"
+	learnActivationKey = "activation_key_codes"
+)
+
+// learnHotkey waits for the next key press, prints its key code and
+// modifiers, and, if setting is not "", saves it to that setting of cfg.
+// It runs the NSApp to watch for the key press, so it doesn't return; it
+// exits once the key has been handled.
+func learnHotkey(cfg RightHandConfig, setting string) {
+	switch setting {
+	case "", learnRetryHotkey, learnConfirmHotkey, learnEmergencyStop, learnToggleHotkey, learnCancelHotkey, learnActivationKey:
+	default:
+		fmt.Fprintf(os.Stderr, "error: can't save a hotkey as %q: must be %s, %s, %s, %s, %s, or %s\n",
+			setting, learnRetryHotkey, learnConfirmHotkey, learnEmergencyStop, learnToggleHotkey, learnCancelHotkey, learnActivationKey)
+		os.Exit(1)
+	}
+	nsApp := cocoa.NSApp_WithDidLaunch(func(n objc.Object) {
+		events := make(chan cocoa.NSEvent, 64)
+		go func() {
+			for e := range events {
+				if e.Get("type").Int() != cocoa.NSEventTypeKeyDown {
+					continue
+				}
+				if err := saveLearnedKey(cfg, setting, e.Get("keyCode").Int(), e.Get("modifierFlags").Int()); err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				os.Exit(0)
+			}
+		}()
+		cocoa.NSEvent_GlobalMonitorMatchingMask(cocoa.NSEventMaskAny, events)
+	})
+	// stay in the background so the key press goes to another app, where the monitor sees it
+	nsApp.SetActivationPolicy(cocoa.NSApplicationActivationPolicyAccessory)
+	fmt.Println("Press the key or chord to learn, such as a footswitch. RightHand needs the Accessibility permission to see it.")
+	nsApp.Run()
+}
+
+// saveLearnedKey prints a learned key press and saves it to setting, if set.
+func saveLearnedKey(cfg RightHandConfig, setting string, keyCode, modifierFlags int64) error {
+	modifiers := modifierFlags & hotkeyModifierMask
+	fmt.Printf("Key code: %d (%#x)\n", keyCode, keyCode)
+	fmt.Printf("Modifier mask: %#x\n", modifiers)
+	name, ok := formatHotkey(keyCode, modifiers)
+	if ok {
+		fmt.Printf("Hotkey: %s\n", name)
+	} else {
+		fmt.Println("This key can't be used in a hotkey setting, only in activation_key_codes")
+	}
+	switch setting {
+	case "":
+		return nil
+	case learnActivationKey:
+		if modifiers != 0 {
+			return fmt.Errorf("%s can't include modifiers; press the key on its own", learnActivationKey)
+		}
+		if !slices.Contains(cfg.ActivationKeyCodes, int(keyCode)) {
+			cfg.ActivationKeyCodes = append(cfg.ActivationKeyCodes, int(keyCode))
+		}
+	default:
+		if !ok {
+			return fmt.Errorf("can't save key code %d as %s", keyCode, setting)
+		}
+		switch setting {
+		case learnRetryHotkey:
+			cfg.RetryHotkey = name
+		case learnConfirmHotkey:
+			cfg.ConfirmHotkey = name
+		case learnEmergencyStop:
+			cfg.EmergencyStop = name
+		case learnToggleHotkey:
+			cfg.ToggleHotkey = name
+		case learnCancelHotkey:
+			cfg.CancelHotkey = name
+		}
+	}
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Printf("Saved to %s in %s\n", setting, configPath())
+	return nil
+}
+
+// formatHotkey returns a key press in the syntax of parseHotkey, such as
+// "control+option+f13", and false if the key is not one of virtualKeyCodes
+// or letterKeyCodes.
+func formatHotkey(keyCode, modifiers int64) (string, bool) {
+	var parts []string
+	for _, m := range []struct {
+		flag int64
+		name string
+	}{
+		{NSEventModifierFlagControl, "control"},
+		{NSEventModifierFlagOption, "option"},
+		{NSEventModifierFlagShift, "shift"},
+		{NSEventModifierFlagCommand, "command"},
+	} {
+		if modifiers&m.flag != 0 {
+			parts = append(parts, m.name)
+		}
+	}
+	for _, codes := range []map[string]int{virtualKeyCodes, letterKeyCodes} {
+		for key, code := range codes {
+			if int64(code) == keyCode {
+				return strings.Join(append(parts, key), "+"), true
+			}
+		}
+	}
+	return "", false
+}
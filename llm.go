@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Language model interfaces selectable with the llm_interface setting.
+const (
+	llmInterfaceChat       = "chat"
+	llmInterfaceCompletion = "completion"
+)
+
+// chatModel is the part of llms.ChatLLM that RightHand uses.
+type chatModel interface {
+	Call(ctx context.Context, messages []schema.ChatMessage, options ...llms.CallOption) (string, error)
+}
+
+// newLLM creates the language model described by cfg.
+func newLLM(cfg RightHandConfig) (chatModel, error) {
+	opts := []openai.Option{openai.WithModel(cfg.LLMModel)}
+	if cfg.LLMBaseURL != "" {
+		opts = append(opts, openai.WithBaseURL(cfg.LLMBaseURL))
+	}
+	key, err := cfg.openAIAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		opts = append(opts, openai.WithToken(key))
+	}
+	switch cfg.LLMInterface {
+	case "", llmInterfaceChat:
+		return openai.NewChat(opts...)
+	case llmInterfaceCompletion:
+		llm, err := openai.New(opts...)
+		if err != nil {
+			return nil, err
+		}
+		return completionModel{llm: llm}, nil
+	default:
+		return nil, fmt.Errorf("unknown llm_interface %q", cfg.LLMInterface)
+	}
+}
+
+// preloadLLM connects to the language model API ahead of the first command,
+// so its DNS lookup and TLS handshake don't slow the command down. The
+// connection is kept by http.DefaultClient, which langchaingo uses. It is
+// meant to be run in its own goroutine; failures are logged.
+func preloadLLM(cfg RightHandConfig) {
+	base := cfg.LLMBaseURL
+	if base == "" {
+		base = os.Getenv("OPENAI_BASE_URL")
+	}
+	if base == "" {
+		base = "https://api.openai.com"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/v1/models", nil)
+	if err != nil {
+		log.Printf("Error preloading language model connection: %v", err)
+		return
+	}
+	if key, err := cfg.openAIAPIKey(); err == nil && key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Error preloading language model connection: %v", err)
+		return
+	}
+	// the connection is only reused once the body has been read
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	log.Printf("Preloaded language model connection in %v (%s)", time.Since(start), resp.Status)
+}
+
+// modelPrefixPattern matches a leading "using <model>," in an utterance.
+var modelPrefixPattern = regexp.MustCompile(`(?is)^\s*using\s+([^,]+),\s*(.*)$`)
+
+// modelPrefix returns the model named by a leading "using <model>," in text
+// and the rest of the text. The model must be llm_model, one of llm_models, or
+// one of their spoken names; otherwise, model is empty and text is returned
+// unchanged, since "using" may be part of the command itself.
+func (c *RightHandConfig) modelPrefix(text string) (model, rest string) {
+	m := modelPrefixPattern.FindStringSubmatch(text)
+	if m == nil {
+		return "", text
+	}
+	spoken := spokenModelKey(m[1])
+	if spoken == spokenModelKey(c.LLMModel) {
+		return c.LLMModel, m[2]
+	}
+	for name, model := range c.LLMModels {
+		if spoken == spokenModelKey(name) || spoken == spokenModelKey(model) {
+			return model, m[2]
+		}
+	}
+	return "", text
+}
+
+// spokenModelKey normalizes a model name for comparison with how it was
+// transcribed, so that "GPT 4" matches "gpt-4".
+func spokenModelKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// llmFor returns a client for the given model, creating it on first use.
+func (app *App) llmFor(cfg *RightHandConfig, model string) (chatModel, error) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if llm, ok := app.llms[model]; ok {
+		return llm, nil
+	}
+	modelCfg := *cfg
+	modelCfg.LLMModel = model
+	llm, err := newLLM(modelCfg)
+	if err != nil {
+		return nil, err
+	}
+	if app.llms == nil {
+		app.llms = make(map[string]chatModel)
+	}
+	app.llms[model] = llm
+	return llm, nil
+}
+
+// completionModel adapts a completion-only language model to chatModel by
+// flattening the messages into a single prompt.
+type completionModel struct {
+	llm llms.LLM
+}
+
+// Call implements chatModel.
+func (m completionModel) Call(ctx context.Context, messages []schema.ChatMessage, options ...llms.CallOption) (string, error) {
+	options = append(options, llms.WithStopWords([]string{"\nHuman:"}))
+	text, err := m.llm.Call(ctx, flattenMessages(messages), options...)
+	return strings.TrimSpace(text), err
+}
+
+// flattenMessages renders messages as a transcript ending with a prompt for the AI's reply.
+func flattenMessages(messages []schema.ChatMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		switch m.GetType() {
+		case schema.ChatMessageTypeSystem:
+			b.WriteString(m.GetText())
+			b.WriteString("\n\n")
+		case schema.ChatMessageTypeAI:
+			fmt.Fprintf(&b, "AI: %s\n", m.GetText())
+		default:
+			fmt.Fprintf(&b, "Human: %s\n", m.GetText())
+		}
+	}
+	b.WriteString("AI:")
+	return b.String()
+}
+
+// printPrompt prints the messages sent to the language model.
+func printPrompt(messages []schema.ChatMessage) {
+	fmt.Println("📝 Prompt:")
+	for _, m := range messages {
+		fmt.Printf("[%s] %s\n", m.GetType(), m.GetText())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// normalizeUtterance lowercases s and strips the surrounding punctuation and
+// extra whitespace that transcription tends to add.
+func normalizeUtterance(s string) string {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	return strings.Trim(s, " .,!?;:")
+}
+
+// macroFor returns the steps of the macro named by the utterance, if any.
+func (c *RightHandConfig) macroFor(utterance string) (name string, steps []string, ok bool) {
+	want := normalizeUtterance(utterance)
+	for macro, macroSteps := range c.Macros {
+		if normalizeUtterance(macro) == want {
+			return macro, macroSteps, true
+		}
+	}
+	return "", nil, false
+}
+
+// macroStepDelay returns the pause between macro steps, falling back to DefaultMacroStepDelay.
+func (c RightHandConfig) macroStepDelay() time.Duration {
+	if c.MacroStepDelay <= 0 {
+		return DefaultMacroStepDelay
+	}
+	return c.MacroStepDelay
+}
+
+// runMacro types each step of a macro into the given application in order,
+// pausing between steps. Steps that are AppleScript snippets are run instead
+// of typed.
+func (app *App) runMacro(ctx context.Context, cfg *RightHandConfig, name string, steps []string, activeApp, bundleID string) {
+	fmt.Printf("⚡ Running macro %q (%d steps)\n", name, len(steps))
+	for i, step := range steps {
+		if i > 0 {
+			select {
+			case <-time.After(cfg.macroStepDelay()):
+			case <-ctx.Done():
+			}
+		}
+		if !app.typeOutput(ctx, cfg, step, activeApp, bundleID) {
+			return
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -10,33 +11,219 @@ import (
 )
 
 var (
+	// flagConfig is a flag to use a config file other than the default one.
+	flagConfig = flag.String("config", "", "use this config file instead of the default one, such as for separate work and personal setups")
 	// flagDumpWAVFile is a flag to dump the audio to a WAV file.
 	flagDumpWAVFile = flag.Bool("dump-wav", false, "dump the audio to a WAV file")
+	// flagVerbose is a flag to print diagnostic details.
+	flagVerbose = flag.Bool("verbose", false, "print diagnostic details, such as whisper segment timestamps")
+	// flagPrintPrompt is a flag to print the messages sent to the language model.
+	flagPrintPrompt = flag.Bool("print-prompt", false, "print the messages sent to the language model")
+	// flagText is a flag to handle the given text as if it were transcribed, then exit.
+	flagText = flag.String("text", "", "handle the given text as if it were spoken, then exit")
+	// flagPromoteExamples is a flag to add logged commands to the config as few-shot examples, then exit.
+	flagPromoteExamples = flag.Bool("promote-examples", false, "add logged commands to the config as few-shot examples, then exit")
+	// flagResetConfig is a flag to back up the config file and replace it with the defaults, then exit.
+	flagResetConfig = flag.Bool("reset-config", false, "back up the config file and replace it with the defaults, then exit")
+	// flagTUI is a flag to show a live status panel instead of scrolling status output.
+	flagTUI = flag.Bool("tui", false, "show a live status panel instead of scrolling status output")
+	// flagExplain is a flag to print how each command was matched against the config.
+	flagExplain = flag.Bool("explain", false, "print which macro, program entry, and examples were used for each command")
+	// flagRecover is a flag to transcribe the audio saved before a crash, then exit.
+	flagRecover = flag.Bool("recover", false, "transcribe the audio saved by crash_recovery before a crash, then exit")
+	// flagCacheInfo is a flag to print the location and size of the whisper model cache, then exit.
+	flagCacheInfo = flag.Bool("cache-info", false, "print the location and size of the whisper model cache, then exit")
+	// flagClearCache is a flag to remove the downloaded whisper models, then exit.
+	flagClearCache = flag.Bool("clear-cache", false, "remove the downloaded whisper models after confirmation, then exit")
+	// flagTrain is a flag to record utterances and corrections of their output to a training dataset.
+	flagTrain = flag.Bool("train", false, "save each utterance's audio and ask for a correction of its output, for a training dataset")
+	// flagQuiet is a flag to skip the startup banner and instructions.
+	flagQuiet = flag.Bool("quiet", false, "skip the startup banner and instructions")
+	// flagCheckConfig is a flag to check the config file for errors, including misspelled chords, then exit.
+	flagCheckConfig = flag.Bool("check-config", false, "check the config file for errors, including misspelled chords in examples, then exit")
+	// flagExportConfig is a flag to write the config without secrets to a file, then exit.
+	flagExportConfig = flag.String("export-config", "", "write the config to this file with API keys and other secrets removed, for sharing, then exit")
+	// flagLearnHotkey is a flag to print the key code and modifiers of the next key pressed, then exit.
+	flagLearnHotkey = flag.Bool("learn-hotkey", false, "print the key code and modifiers of the next key or chord pressed, such as a footswitch, then exit")
+	// flagSaveHotkeyAs is a flag to save the key learned with -learn-hotkey to a setting.
+	flagSaveHotkeyAs = flag.String("save-hotkey-as", "", "with -learn-hotkey, save the key to this setting: retry_hotkey, confirm_hotkey, emergency_stop, toggle_hotkey, cancel_hotkey, or activation_key_codes")
+	// flagSelfTest is a flag to type a test string into TextEdit and check that it arrived, then exit.
+	flagSelfTest = flag.Bool("self-test", false, "type a test string into a new TextEdit document and check that it arrived, to diagnose permissions, then exit")
+	// flagVersion is a flag to print the version and build information, then exit.
+	flagVersion = flag.Bool("version", false, "print the version and build information, then exit")
 
 	// DefaultTimeout is the default timeout for listening.
 	DefaultTimeout = 30 * time.Second
+
+	// DefaultLLMTimeout is the default timeout for a language model call.
+	DefaultLLMTimeout = 30 * time.Second
+
+	// DefaultDoublePressInterval is the default maximum time between the presses of a double-press.
+	DefaultDoublePressInterval = 500 * time.Millisecond
+
+	// DefaultMacroStepDelay is the default pause between the steps of a macro.
+	DefaultMacroStepDelay = 200 * time.Millisecond
+
+	// DefaultSlowTranscription is the default average transcription time above which fallback_whisper_model is used.
+	DefaultSlowTranscription = 3 * time.Second
+
+	// DefaultMaxConfirmedExamples is the default number of examples for an app beyond which confirm_hotkey saves no more.
+	DefaultMaxConfirmedExamples = 50
+
+	// DefaultCharDelay is the default pause between characters with char_by_char.
+	DefaultCharDelay = 20 * time.Millisecond
+
+	// DefaultChordSeparators are the characters, one of which is dropped after a chord.
+	DefaultChordSeparators = " ;,.\n"
+
+	// DefaultEmergencyStop is the default hotkey that stops all input and disables RightHand.
+	DefaultEmergencyStop = "command+shift+escape"
+
+	// DefaultToggleHotkey is the default hotkey that disables or enables RightHand.
+	DefaultToggleHotkey = "control+shift+f11"
+
+	// DefaultCancelHotkey is the default hotkey that cancels the command in progress.
+	DefaultCancelHotkey = "control+shift+escape"
 )
 
 // main is the entrypoint.
 func main() {
 	runtime.LockOSThread()
+	flag.Usage = usage
 	flag.Parse()
 	ctx := context.Background()
 
+	// the subcommand, which may be followed by more flags
+	command := "run"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
+	if *flagVersion {
+		printVersion()
+		return
+	}
+
+	if *flagCacheInfo || *flagClearCache {
+		manage := printCacheInfo
+		if *flagClearCache {
+			manage = clearCache
+		}
+		if err := manage(); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *flagResetConfig {
+		backup, err := resetConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error resetting config:", err)
+			os.Exit(1)
+		}
+		if backup != "" {
+			fmt.Println("Backed up config to", backup)
+		}
+		fmt.Println("Wrote default config to", configPath())
+		return
+	}
+
 	// load config
 	cfg, err := loadConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
 	}
+	if *flagCheckConfig {
+		if err != nil || !checkConfig(cfg) {
+			os.Exit(1)
+		}
+		return
+	}
+	if *flagExportConfig != "" {
+		if err != nil {
+			os.Exit(1) // don't export the defaults in place of a config that failed to load
+		}
+		if err := exportConfig(cfg, *flagExportConfig); err != nil {
+			fmt.Fprintln(os.Stderr, "error exporting config:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Wrote config without secrets to", *flagExportConfig)
+		return
+	}
+	if *flagLearnHotkey {
+		if err != nil && *flagSaveHotkeyAs != "" {
+			os.Exit(1) // don't overwrite a config that failed to load
+		}
+		learnHotkey(cfg, *flagSaveHotkeyAs)
+		return
+	}
+	if *flagSelfTest {
+		if err := runSelfTest(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *flagPromoteExamples {
+		if err != nil {
+			os.Exit(1) // don't overwrite a config that failed to load
+		}
+		n, err := promoteExamples(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error promoting examples:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Added %d examples to %s\n", n, configPath())
+		return
+	}
+	if command != "run" {
+		if err := runCommand(cfg, command, flag.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	// process flags
 	cfg.DumpWAVFile = *flagDumpWAVFile
+	cfg.NoAudio = *flagText != ""
+	cfg.Verbose = *flagVerbose
+	cfg.PrintPrompt = *flagPrintPrompt
+	cfg.TUI = *flagTUI
+	cfg.Explain = *flagExplain
+	cfg.Training = *flagTrain
+	cfg.QuietFlag = *flagQuiet
 
 	// create app
 	app, err := newApp(cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error initializing app:", err)
+		switch {
+		case errors.Is(err, ErrInvalidConfig):
+			fmt.Fprintln(os.Stderr, "fix the config file at", configPath())
+		case errors.Is(err, ErrNoInputDevice):
+			fmt.Fprintln(os.Stderr, "connect a microphone and check System Settings > Sound > Input, or pass a command with -text")
+		case errors.Is(err, ErrWhisperInit):
+			fmt.Fprintln(os.Stderr, "check that PortAudio is installed and the whisper model can be downloaded")
+		case errors.Is(err, ErrLLMInit):
+			fmt.Fprintln(os.Stderr, "check that OPENAI_API_KEY is set")
+		}
 		os.Exit(1)
 	}
+	// transcribe the audio of a session interrupted by a crash
+	if *flagRecover {
+		if err := app.recoverRecordings(); err != nil {
+			fmt.Fprintln(os.Stderr, "error recovering audio:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// handle text input without audio
+	if *flagText != "" {
+		app.handleText(ctx, *flagText)
+		return
+	}
 	// run app
 	if err := app.run(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, "error running app:", err)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/progrium/macdriver/cocoa"
+	"github.com/progrium/macdriver/core"
+	"github.com/progrium/macdriver/objc"
+)
+
+// menuBarIcons are the menu bar titles for each state shown by setState.
+var menuBarIcons = map[string]string{
+	"Ready":      "🖐️",
+	"Listening":  "🔴",
+	"Processing": "⏳",
+	"Disabled":   "💤",
+}
+
+// menuBar is a menu bar status item showing whether RightHand is listening,
+// with a menu to enable or disable RightHand and to quit. The status item
+// is only touched on the main thread. Methods on a nil *menuBar do nothing.
+type menuBar struct {
+	item  cocoa.NSStatusItem
+	shown bool // set once install has run
+}
+
+// install adds the status item to the menu bar. It must run on the main
+// thread, once the application has launched.
+func (m *menuBar) install(app *App) {
+	if m == nil {
+		return
+	}
+	m.item = cocoa.NSStatusBar_System().StatusItemWithLength(cocoa.NSVariableStatusItemLength)
+	m.item.Retain()
+	m.shown = true
+
+	toggle := cocoa.NSMenuItem_New()
+	toggle.SetTitle("Enable / Disable")
+	toggle.SetAction(objc.Sel("toggleEnabled:"))
+	cocoa.DefaultDelegateClass.AddMethod("toggleEnabled:", func(_ objc.Object) {
+		app.toggleEnabled()
+	})
+	quit := cocoa.NSMenuItem_New()
+	quit.SetTitle("Quit RightHand")
+	quit.SetAction(objc.Sel("terminate:"))
+
+	menu := cocoa.NSMenu_New()
+	menu.AddItem(toggle)
+	menu.AddItem(cocoa.NSMenuItem_Separator())
+	menu.AddItem(quit)
+	m.item.SetMenu(menu)
+	app.showIdle()
+}
+
+// setState shows state, such as "Listening", in the menu bar.
+func (m *menuBar) setState(state string) {
+	if m == nil {
+		return
+	}
+	core.Dispatch(func() {
+		if m.shown {
+			m.item.Button().SetTitle(menuBarIcons[state])
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+const (
+	// levelBarWidth is the number of cells in the microphone level bar.
+	levelBarWidth = 20
+	// levelFloorDB is the level shown as an empty bar, in dBFS.
+	levelFloorDB = -60
+	// levelRedrawInterval is how often the level meter is redrawn.
+	levelRedrawInterval = 100 * time.Millisecond
+	// silenceThresholdDB is the RMS level below which a frame counts as silence, in dBFS.
+	silenceThresholdDB = -50
+	// silenceFrame is the number of samples in each frame checked for silence, 10ms.
+	silenceFrame = whisper.SampleRate / 100
+)
+
+// audioLevel returns the RMS and peak amplitude of samples.
+func audioLevel(samples []float32) (rms, peak float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, s := range samples {
+		v := math.Abs(float64(s))
+		sum += v * v
+		peak = math.Max(peak, v)
+	}
+	return math.Sqrt(sum / float64(len(samples))), peak
+}
+
+// audioStats returns a summary of samples for log_audio_stats: their
+// duration, count, RMS and peak level, and the fraction of silent frames.
+func audioStats(samples []float32) string {
+	rms, peak := audioLevel(samples)
+	var frames, silent int
+	for i := 0; i < len(samples); i += silenceFrame {
+		frame, _ := audioLevel(samples[i:min(i+silenceFrame, len(samples))])
+		if decibels(frame) < silenceThresholdDB {
+			silent++
+		}
+		frames++
+	}
+	silence := 0.0
+	if frames > 0 {
+		silence = float64(silent) / float64(frames)
+	}
+	duration := time.Duration(len(samples)) * time.Second / time.Duration(whisper.SampleRate)
+	return fmt.Sprintf("duration=%v samples=%d rms_db=%.1f peak_db=%.1f silence_ratio=%.2f",
+		duration.Round(time.Millisecond), len(samples), decibels(rms), decibels(peak), silence)
+}
+
+// decibels converts an amplitude to dBFS, no lower than levelFloorDB.
+func decibels(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return levelFloorDB
+	}
+	return math.Max(20*math.Log10(amplitude), levelFloorDB)
+}
+
+// levelBar renders the RMS level of samples as a bar, followed by the peak in dBFS.
+func levelBar(samples []float32) string {
+	rms, peak := audioLevel(samples)
+	n := int(math.Round((decibels(rms) - levelFloorDB) / -levelFloorDB * levelBarWidth))
+	n = max(0, min(n, levelBarWidth)) // a level above full scale would overflow the bar
+	return fmt.Sprintf("%s%s peak %3.0f dB", strings.Repeat("█", n), strings.Repeat("░", levelBarWidth-n), decibels(peak))
+}
+
+// levelMeter shows the microphone level while listening, on its own line of
+// the terminal or, with -tui, in the status panel.
+type levelMeter struct {
+	status *statusPanel // nil unless running with -tui
+	drawn  time.Time
+}
+
+// update shows the level of the latest audio, at most every levelRedrawInterval.
+func (m *levelMeter) update(samples []float32) {
+	if time.Since(m.drawn) < levelRedrawInterval {
+		return
+	}
+	m.drawn = time.Now()
+	if m.status != nil {
+		m.status.setLevel(levelBar(samples))
+		return
+	}
+	fmt.Printf("\r🎚️  %s", levelBar(samples))
+}
+
+// clear removes the meter once listening stops.
+func (m *levelMeter) clear() {
+	if m.drawn.IsZero() {
+		return
+	}
+	m.drawn = time.Time{}
+	if m.status != nil {
+		m.status.setLevel("")
+		return
+	}
+	fmt.Print("\r\x1b[K") // return to the start of the line and clear it
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLevelBar(t *testing.T) {
+	tests := []struct {
+		samples []float32
+		full    int // cells filled
+	}{
+		{samples: nil, full: 0},
+		{samples: []float32{0, 0, 0}, full: 0},
+		{samples: []float32{1, -1, 1}, full: levelBarWidth},
+		{samples: []float32{4, -4, 4}, full: levelBarWidth}, // above full scale
+	}
+	for _, tt := range tests {
+		bar := levelBar(tt.samples)
+		if got := strings.Count(bar, "█"); got != tt.full {
+			t.Errorf("levelBar(%v) = %q, with %d cells filled, want %d", tt.samples, bar, got, tt.full)
+		}
+		if got := strings.Count(bar, "█") + strings.Count(bar, "░"); got != levelBarWidth {
+			t.Errorf("levelBar(%v) = %q, with %d cells, want %d", tt.samples, bar, got, levelBarWidth)
+		}
+	}
+}
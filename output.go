@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// stripCodeFences removes a Markdown code fence, and its optional language
+// tag, surrounding the whole of s. Text that isn't fenced is returned unchanged.
+func stripCodeFences(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) < 6 || !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") {
+		return s
+	}
+	inner := trimmed[3 : len(trimmed)-3]
+	if tag, rest, ok := strings.Cut(inner, "\n"); ok && !strings.ContainsAny(strings.TrimSpace(tag), " \t") {
+		inner = rest
+	}
+	return strings.Trim(inner, "\n")
+}
+
+// lowercaseFirstWord lowercases the first word of s if it is capitalized, as
+// in "Cd ~". Words in all caps, such as "README", are left alone.
+func lowercaseFirstWord(s string) string {
+	start := len(s) - len(strings.TrimLeft(s, " \t\n"))
+	end := strings.IndexAny(s[start:], " \t\n")
+	if end < 0 {
+		end = len(s)
+	} else {
+		end += start
+	}
+	word := s[start:end]
+	if word == "" || strings.HasPrefix(word, "{") {
+		return s // chords keep their case
+	}
+	rest := []rune(word)[1:]
+	if string(rest) != strings.ToLower(string(rest)) || !unicode.IsUpper([]rune(word)[0]) {
+		return s
+	}
+	return s[:start] + strings.ToLower(word) + s[end:]
+}
+
+// Replacement is a regexp substitution applied to the language model's
+// output, such as one fixing a word whisper often gets wrong.
+type Replacement struct {
+	Pattern string `json:"pattern"` // regexp in Go syntax, e.g. \bget hub\b
+	Replace string `json:"replace"` // replacement text; $1 and ${name} refer to submatches
+}
+
+// compileReplacements compiles the patterns of the replacements for
+// applyReplacements. Invalid patterns are left out; validate reports them.
+func (c *RightHandConfig) compileReplacements() {
+	c.replacePatterns = make([]*regexp.Regexp, len(c.Replacements))
+	for i, r := range c.Replacements {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			log.Printf("Skipping replacement %q: %v", r.Pattern, err)
+			continue
+		}
+		c.replacePatterns[i] = re
+	}
+}
+
+// applyReplacements applies the replacements to s in order.
+func (c *RightHandConfig) applyReplacements(s string) string {
+	for i, re := range c.replacePatterns {
+		if re != nil {
+			s = re.ReplaceAllString(s, c.Replacements[i].Replace)
+		}
+	}
+	return s
+}
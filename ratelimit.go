@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitBurst is the default number of commands allowed in quick
+// succession with max_commands_per_minute.
+const DefaultRateLimitBurst = 3
+
+// tokenBucket limits how often commands run. It holds up to burst tokens,
+// refilled at a steady rate; each command takes one.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last refilled; zero before the first take
+}
+
+// take takes a token if one is available at now, refilling perMinute tokens
+// a minute up to burst. It reports whether a token was taken.
+func (b *tokenBucket) take(now time.Time, perMinute, burst int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+		b.tokens = min(b.tokens, float64(burst))
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimitBurst returns the number of commands allowed in quick succession
+// with max_commands_per_minute.
+func (c *RightHandConfig) rateLimitBurst() int {
+	if c.RateLimitBurst <= 0 {
+		return DefaultRateLimitBurst
+	}
+	return c.RateLimitBurst
+}
+
+// allowCommand reports whether a command may run under max_commands_per_minute,
+// reporting it if not. It always allows commands when no limit is set.
+func (app *App) allowCommand(cfg *RightHandConfig) bool {
+	if cfg.MaxCommandsPerMinute <= 0 {
+		return true
+	}
+	if app.limiter.take(time.Now(), cfg.MaxCommandsPerMinute, cfg.rateLimitBurst()) {
+		return true
+	}
+	fmt.Printf("🚦 Too many commands (more than %d a minute); dropping this one\n", cfg.MaxCommandsPerMinute)
+	log.Printf("Rate limit: dropped a command over max_commands_per_minute %d", cfg.MaxCommandsPerMinute)
+	app.status.addError()
+	return false
+}
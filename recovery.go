@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+// recoveryPattern is the pattern of the names of recordings kept for crash
+// recovery, in the temporary directory. Each utterance has its own recording,
+// since utterances may wait to be transcribed while the next is recorded.
+const recoveryPattern = "righthand-recording-*.wav"
+
+// recoveryRecording appends the audio of an utterance to a WAV file as it is
+// captured, so that it can be transcribed with -recover after a crash.
+// Methods on a nil *recoveryRecording do nothing.
+type recoveryRecording struct {
+	f *os.File
+}
+
+// createRecoveryRecording starts a new recording in the temporary directory.
+func createRecoveryRecording() (*recoveryRecording, error) {
+	f, err := os.CreateTemp("", recoveryPattern)
+	if err != nil {
+		return nil, err
+	}
+	// The sizes are unknown while recording, so they are written as the
+	// maximum, as is usual for streamed WAV data; readers use the file size.
+	header := appendWAVHeader(make([]byte, 0, wavHeaderSize), 3, 32, math.MaxUint32) // IEEE float
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &recoveryRecording{f: f}, nil
+}
+
+// write appends samples to the recording.
+func (r *recoveryRecording) write(samples []float32) error {
+	if r == nil {
+		return nil
+	}
+	buf := make([]byte, 0, len(samples)*4)
+	for _, s := range samples {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(s))
+	}
+	_, err := r.f.Write(buf)
+	return err
+}
+
+// remove closes and deletes the recording once it is no longer needed.
+func (r *recoveryRecording) remove() error {
+	if r == nil {
+		return nil
+	}
+	r.f.Close()
+	return os.Remove(r.f.Name())
+}
+
+// recoverRecordings transcribes and prints the recordings left behind by a
+// crash, oldest first, removing each once it is transcribed.
+func (app *App) recoverRecordings() error {
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), recoveryPattern))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Println("No recording to recover")
+		return nil
+	}
+	modTime := func(path string) time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	sort.Slice(paths, func(i, j int) bool { return modTime(paths[i]).Before(modTime(paths[j])) })
+	for _, path := range paths {
+		samples, err := readWAV(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("Transcribing %v of recovered audio...\n", time.Duration(len(samples))*time.Second/time.Duration(whisper.SampleRate))
+		text, err := app.transcribe(samples, "")
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("💬 You said: %q\n", text)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+// retryHotkey returns the hotkey that re-transcribes the last utterance with
+// retry_whisper_model, and false if it is not configured.
+func (c RightHandConfig) retryHotkey() (hotkey, bool) {
+	if c.RetryHotkey == "" || c.RetryWhisperModel == "" {
+		return hotkey{}, false
+	}
+	h, err := parseHotkey(c.RetryHotkey)
+	return h, err == nil
+}
+
+// retryEmpty asks the user to try again after nothing was transcribed from u,
+// up to empty_retries times in a row. With empty_retry_listen_ms set, it also
+// starts listening again for the same intent.
+func (app *App) retryEmpty(u *utterance) {
+	cfg := app.config()
+	if cfg.EmptyRetries <= 0 {
+		return
+	}
+	if app.emptyAttempts.Add(1) > int32(cfg.EmptyRetries) {
+		app.emptyAttempts.Store(0)
+		fmt.Println("🙉 Still didn't catch that, giving up")
+		return
+	}
+	fmt.Println("🙉 I didn't catch that, try again")
+	if cfg.EmptyRetryListenMs > 0 {
+		select {
+		case app.relisten <- u.intent:
+		default: // already asked
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/progrium/macdriver/cocoa"
+	"github.com/progrium/macdriver/core"
+	"github.com/progrium/macdriver/objc"
+)
+
+// Autoresizing masks for the views of the review window.
+const (
+	viewMinXMargin    = 1 << 0
+	viewWidthSizable  = 1 << 1
+	viewHeightSizable = 1 << 4
+)
+
+// reviewDecision is what the user chose in the review window.
+type reviewDecision struct {
+	text   string // the output as edited
+	insert bool   // false if the output was discarded
+}
+
+// reviewWindow is a floating window in which output is edited before it is
+// inserted, for output_target: review. It is only touched on the main thread.
+type reviewWindow struct {
+	window  cocoa.NSWindow
+	text    cocoa.NSTextView
+	created bool
+	decided chan<- reviewDecision // nil unless the window is shown
+}
+
+// create builds the window, with its text view and buttons.
+func (r *reviewWindow) create() {
+	// the window is hidden rather than closed, but RightHand must not quit if it is
+	cocoa.TerminateAfterWindowsClose = false
+	r.window = cocoa.NSWindow_Init(core.Rect(0, 0, 520, 260),
+		cocoa.NSTitledWindowMask|cocoa.NSResizableWindowMask, cocoa.NSBackingStoreBuffered, false)
+	r.window.SetTitle("RightHand: review output")
+	r.window.SetLevel(cocoa.NSFloatingWindowLevel)
+	r.window.SetReleasedWhenClosed(false)
+	r.window.Retain()
+	r.window.Center()
+
+	r.text = cocoa.NSTextView_Init(core.Rect(10, 50, 500, 200))
+	r.text.Set("autoresizingMask:", viewWidthSizable|viewHeightSizable)
+	insert := cocoa.NSButton_ButtonWithTitleTargetAction(core.String("Insert (⌘↩)"), nil, objc.Sel("insertReview:"))
+	insert.SetKeyEquivalent(core.String("\r"))
+	insert.Set("keyEquivalentModifierMask:", NSEventModifierFlagCommand)
+	insert.SetFrame(core.Rect(390, 10, 120, 30))
+	insert.Set("autoresizingMask:", viewMinXMargin)
+	discard := cocoa.NSButton_ButtonWithTitleTargetAction(core.String("Discard (esc)"), nil, objc.Sel("discardReview:"))
+	discard.SetKeyEquivalent(core.String("\x1b"))
+	discard.SetFrame(core.Rect(260, 10, 120, 30))
+	discard.Set("autoresizingMask:", viewMinXMargin)
+	content := r.window.ContentView()
+	content.AddSubview(r.text)
+	content.AddSubview(insert)
+	content.AddSubview(discard)
+
+	cocoa.DefaultDelegateClass.AddMethod("insertReview:", func(_ objc.Object) {
+		r.decide(true)
+	})
+	cocoa.DefaultDelegateClass.AddMethod("discardReview:", func(_ objc.Object) {
+		r.decide(false)
+	})
+	r.created = true
+}
+
+// show shows text in the window, in front of other apps, and sends what the
+// user chooses on decided, which must be buffered.
+func (r *reviewWindow) show(text string, decided chan<- reviewDecision) {
+	if !r.created {
+		r.create()
+	}
+	r.decided = decided
+	r.text.SetString(text)
+	cocoa.NSApp().ActivateIgnoringOtherApps(true)
+	r.window.MakeKeyAndOrderFront(nil)
+	r.window.Send("makeFirstResponder:", r.text)
+}
+
+// decide sends the user's choice and hides the window.
+func (r *reviewWindow) decide(insert bool) {
+	if r.decided == nil {
+		return
+	}
+	r.decided <- reviewDecision{text: r.text.String(), insert: insert}
+	r.hide()
+}
+
+// hide hides the window without a choice, for a cancelled command.
+func (r *reviewWindow) hide() {
+	r.decided = nil
+	if r.created {
+		r.window.OrderOut(nil)
+	}
+}
+
+// reviewOutput shows output in the review window and, once the user chooses
+// to insert it, activates the app that was frontmost and runs typing with
+// the edited text, pasting it rather than typing it key by key. The clipboard
+// is restored according to preserve_clipboard for the given application. It
+// reports false if the output was discarded, or if the command was cancelled or failed.
+func (app *App) reviewOutput(ctx context.Context, cfg *RightHandConfig, output, activeApp, bundleID string, typing func(exec Executor, text string) error) bool {
+	pid := frontmostPID()
+	decided := make(chan reviewDecision, 1)
+	core.Dispatch(func() { app.review.show(output, decided) })
+	fmt.Println("📝 Review the output, then press Command + Return to insert it or Escape to discard it")
+	var d reviewDecision
+	select {
+	case d = <-decided:
+	case <-ctx.Done():
+		core.Dispatch(app.review.hide)
+		fmt.Println("🛑 Command cancelled")
+		return false
+	}
+	if !d.insert {
+		fmt.Println("🗑️  Discarded the output")
+		return false
+	}
+	if pid != 0 {
+		activateProcess(pid)
+	}
+	return app.execute(cfg, activeApp, bundleID, func(exec Executor) error {
+		if cfg.Executor != executorLog {
+			exec = clipboardExecutor{pasteboardType: cfg.PasteboardType, noRestore: !cfg.preserveClipboardFor(activeApp, bundleID)}
+		}
+		return typing(exec, d.text)
+	})
+}
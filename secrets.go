@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/goccy/go-yaml"
+)
+
+// secrets holds credentials read from the file named by the secrets_file setting.
+type secrets struct {
+	OpenAIAPIKey string `json:"openai_api_key"`
+}
+
+// openAIAPIKey returns the OpenAI API key to use, or "" to let the client
+// read OPENAI_API_KEY itself. The environment takes precedence over the
+// config file, which takes precedence over the secrets file.
+func (c RightHandConfig) openAIAPIKey() (string, error) {
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		return "", nil
+	}
+	if c.OpenAIAPIKey != "" {
+		warnIfWorldReadable(configPath())
+		return c.OpenAIAPIKey, nil
+	}
+	if c.SecretsFile == "" {
+		return "", nil
+	}
+	f, err := os.Open(c.SecretsFile)
+	if err != nil {
+		return "", fmt.Errorf("reading secrets file: %w", err)
+	}
+	defer f.Close()
+	var s secrets
+	if err := yaml.NewDecoder(f).Decode(&s); err != nil {
+		return "", fmt.Errorf("reading secrets file %s: %w", c.SecretsFile, err)
+	}
+	if s.OpenAIAPIKey != "" {
+		warnIfWorldReadable(c.SecretsFile)
+	}
+	return s.OpenAIAPIKey, nil
+}
+
+// warnIfWorldReadable warns that the file at path, which holds credentials, can be read by other users.
+func warnIfWorldReadable(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm()&0o004 == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  WARNING: %s contains an API key but is readable by all users. Run: chmod 600 %s\n", path, path)
+}
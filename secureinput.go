@@ -0,0 +1,14 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include <Carbon/Carbon.h>
+*/
+import "C"
+
+// secureInputEnabled reports whether an application has turned on secure event
+// input, as password fields do while focused. While it is on, macOS drops
+// synthesized key presses without reporting an error.
+func secureInputEnabled() bool {
+	return C.IsSecureEventInputEnabled() != 0
+}
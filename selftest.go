@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// selfTestText is the text typed into TextEdit by the self-test.
+const selfTestText = "RightHand self-test 42"
+
+// runSelfTest opens a new TextEdit document, types selfTestText into it with
+// the configured executor, and reads the document back to check that the text
+// arrived. On failure it prints how to grant the permissions typing needs.
+func runSelfTest(cfg RightHandConfig) error {
+	if cfg.Executor == executorLog {
+		return errors.New("the log executor prints input instead of typing it; set executor to robotgo, clipboard, or applescript to run the self-test")
+	}
+	exec, err := newExecutor(cfg.Executor, cfg.PasteboardType)
+	if err != nil {
+		return err
+	}
+	setKeyMap(cfg.KeyMap)
+	if secureInputEnabled() {
+		printPermissionHelp()
+		return errors.New("secure input is on, so macOS would drop typed input; close any focused password field, or turn off Secure Keyboard Entry in Terminal")
+	}
+
+	fmt.Println("Opening a new TextEdit document; don't touch the keyboard or mouse until the test is done")
+	if err := runAppleScript(`tell application "TextEdit"
+	activate
+	make new document
+end tell`); err != nil {
+		printPermissionHelp()
+		return fmt.Errorf("opening TextEdit: %w", err)
+	}
+	time.Sleep(time.Second) // let the document take focus
+	if err := simulateTyping(context.Background(), exec, selfTestText, newlineLiteral); err != nil {
+		printPermissionHelp()
+		return fmt.Errorf("typing: %w", err)
+	}
+	time.Sleep(500 * time.Millisecond) // let the input arrive
+
+	typed, err := textEditDocumentText()
+	if err != nil {
+		fmt.Println("⚠️  Could not read the document back, so check it yourself: it should contain", selfTestText)
+		return err
+	}
+	// the document was made for the test, so close it without asking to save
+	runAppleScript(`tell application "TextEdit" to close front document saving no`)
+	if strings.TrimSpace(typed) != selfTestText {
+		printPermissionHelp()
+		return fmt.Errorf("typed %q, but the document contains %q", selfTestText, typed)
+	}
+	fmt.Println("✅ Self-test passed: RightHand can type")
+	return nil
+}
+
+// textEditDocumentText returns the text of the front TextEdit document.
+func textEditDocumentText() (string, error) {
+	out, err := exec.Command("osascript", "-e", `tell application "TextEdit" to get text of front document`).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("osascript: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// printPermissionHelp prints how to grant the permissions RightHand needs to type.
+func printPermissionHelp() {
+	fmt.Println("❌ Self-test failed. RightHand needs these permissions for the app that runs it, such as Terminal or iTerm:")
+	fmt.Println("  - Accessibility, to type and press keys: System Settings > Privacy & Security > Accessibility")
+	fmt.Println("  - Input Monitoring, to see its hotkeys: System Settings > Privacy & Security > Input Monitoring")
+	fmt.Println("  - Automation of TextEdit and System Events, for the self-test and the applescript executor: System Settings > Privacy & Security > Automation")
+	fmt.Println("After granting a permission, quit and reopen that app, then run righthand -self-test again.")
+}
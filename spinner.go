@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// spinnerFrames are drawn in turn while a slow startup step runs.
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// startSpinner shows message with a spinner and the time elapsed until the
+// returned stop function is called, which replaces it with the total time.
+// whisper.cpp doesn't report loading progress, so this shows that startup is
+// still going rather than how far along it is.
+func startSpinner(message string) (stop func()) {
+	start := time.Now()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Printf("\r%c %s (%ds)", spinnerFrames[i%len(spinnerFrames)], message, int(time.Since(start).Seconds()))
+			select {
+			case <-ticker.C:
+			case <-done:
+				fmt.Printf("\r%s (%v)\033[K\n", message, time.Since(start).Round(100*time.Millisecond))
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
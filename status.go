@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// statusPanel is a compact live view of RightHand's state, redrawn in place
+// in the terminal. It is used instead of scrolling status output with -tui.
+// Methods on a nil *statusPanel do nothing.
+type statusPanel struct {
+	out     *os.File
+	hotkeys string // shown at the bottom, from hotkeyHelp
+
+	mu            sync.Mutex
+	state         string
+	transcription string
+	command       string
+	level         string // microphone level bar, shown while listening
+	errors        int
+	updated       time.Time
+}
+
+// newStatusPanel returns a panel that draws to out, listing hotkeys at the bottom.
+func newStatusPanel(out *os.File, hotkeys string) *statusPanel {
+	return &statusPanel{out: out, hotkeys: hotkeys, state: "Ready"}
+}
+
+// hotkeyHelp returns a one-line summary of the hotkeys that control RightHand.
+func (c RightHandConfig) hotkeyHelp() string {
+	return fmt.Sprintf("Command + Control: listen   %s: cancel   %s: enable/disable", c.cancelHotkeyName(), c.toggleHotkeyName())
+}
+
+// setState sets the state line, such as "Listening" or "Processing".
+func (p *statusPanel) setState(state string) {
+	p.update(func() { p.state = state })
+}
+
+// setTranscription sets the last transcription.
+func (p *statusPanel) setTranscription(text string) {
+	p.update(func() { p.transcription = text })
+}
+
+// setCommand sets the last executed command.
+func (p *statusPanel) setCommand(command string) {
+	p.update(func() { p.command = command })
+}
+
+// setLevel sets the microphone level bar, or hides it if level is empty.
+func (p *statusPanel) setLevel(level string) {
+	p.update(func() { p.level = level })
+}
+
+// addError counts an error.
+func (p *statusPanel) addError() {
+	p.update(func() { p.errors++ })
+}
+
+// update applies f and redraws the panel.
+func (p *statusPanel) update(f func()) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f()
+	p.updated = time.Now()
+	p.draw()
+}
+
+// draw clears the terminal and draws the panel. p.mu must be held.
+func (p *statusPanel) draw() {
+	fmt.Fprint(p.out, "\x1b[H\x1b[2J") // cursor home, clear screen
+	fmt.Fprintln(p.out, "RightHand - Voice Control Assistant")
+	fmt.Fprintln(p.out, "===================================")
+	fmt.Fprintf(p.out, "State:    %s\n", p.state)
+	if p.level != "" {
+		fmt.Fprintf(p.out, "Level:    %s\n", p.level)
+	}
+	fmt.Fprintf(p.out, "Heard:    %q\n", p.transcription)
+	fmt.Fprintf(p.out, "Command:  %q\n", p.command)
+	fmt.Fprintf(p.out, "Errors:   %d\n", p.errors)
+	fmt.Fprintf(p.out, "Updated:  %s\n", p.updated.Format(time.TimeOnly))
+	fmt.Fprintln(p.out, "\n"+p.hotkeys)
+}
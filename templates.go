@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Template is a spoken command with arguments, such as "open project foo",
+// whose output is filled in from what was said, bypassing the language model.
+type Template struct {
+	Trigger string `json:"trigger"` // regexp matched against the whole utterance, ignoring case, e.g. open project (?P<arg>\S+)
+	Output  string `json:"output"`  // Go template typed on a match; {{.arg}} is the text captured by the group named arg
+}
+
+// compiledTemplate is a Template ready to match and expand.
+type compiledTemplate struct {
+	trigger *regexp.Regexp
+	output  *template.Template
+}
+
+// compile compiles t, and checks that its output only refers to the named
+// groups of its trigger.
+func (t Template) compile() (compiledTemplate, error) {
+	trigger, err := regexp.Compile(`(?i)^(?:` + t.Trigger + `)$`)
+	if err != nil {
+		return compiledTemplate{}, err
+	}
+	output, err := template.New(t.Trigger).Option("missingkey=error").Parse(t.Output)
+	if err != nil {
+		return compiledTemplate{}, err
+	}
+	if err := output.Execute(&strings.Builder{}, captures(trigger, nil)); err != nil {
+		return compiledTemplate{}, err
+	}
+	return compiledTemplate{trigger: trigger, output: output}, nil
+}
+
+// captures maps the names of the groups of re to their text in match, or
+// to "" if match is nil.
+func captures(re *regexp.Regexp, match []string) map[string]string {
+	args := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		args[name] = ""
+		if match != nil {
+			args[name] = match[i]
+		}
+	}
+	return args
+}
+
+// compileTemplates compiles the templates for templateFor. Invalid templates
+// are left out; validate reports them.
+func (c *RightHandConfig) compileTemplates() {
+	c.templates = nil
+	for _, t := range c.Templates {
+		compiled, err := t.compile()
+		if err != nil {
+			log.Printf("Skipping template %q: %v", t.Trigger, err)
+			continue
+		}
+		c.templates = append(c.templates, compiled)
+	}
+}
+
+// templateFor returns the output of the first template whose trigger matches
+// the utterance, ignoring surrounding punctuation and extra whitespace.
+func (c *RightHandConfig) templateFor(utterance string) (trigger, output string, ok bool, err error) {
+	utterance = strings.Trim(strings.Join(strings.Fields(utterance), " "), " .,!?;:")
+	for _, t := range c.templates {
+		match := t.trigger.FindStringSubmatch(utterance)
+		if match == nil {
+			continue
+		}
+		var b strings.Builder
+		if err := t.output.Execute(&b, captures(t.trigger, match)); err != nil {
+			return t.output.Name(), "", true, err
+		}
+		return t.output.Name(), b.String(), true, nil
+	}
+	return "", "", false, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmc/audioutil/wavutil"
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+// trainingEntry pairs a recorded utterance with what RightHand made of it
+// and the user's correction, in the training dataset.
+type trainingEntry struct {
+	Time          time.Time `json:"time"`
+	Program       string    `json:"program"`
+	BundleID      string    `json:"bundle_id,omitempty"`
+	Audio         string    `json:"audio"` // WAV file, relative to the dataset
+	Transcription string    `json:"transcription"`
+	Output        string    `json:"output"`
+	Correction    string    `json:"correction"` // the output that should have been produced; the same as Output if it was right
+}
+
+// trainingDir returns the directory of the training dataset, next to the config file.
+func trainingDir() string {
+	return filepath.Join(filepath.Dir(configPath()), "training")
+}
+
+// stdin reads the corrections typed during -train.
+var stdin = bufio.NewReader(os.Stdin)
+
+// recordTraining saves the audio of u with its transcription and output to
+// the training dataset, asking the user for the correct output first.
+func (app *App) recordTraining(u *utterance, transcription, output, activeApp, bundleID string) {
+	now := time.Now()
+	dir := trainingDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Error creating training dataset: %v", err)
+		return
+	}
+	audio := now.Format("20060102-150405.000") + ".wav"
+	// SaveWAV scales the samples in place, and retry_hotkey may transcribe them again
+	if err := wavutil.SaveWAV(filepath.Join(dir, audio), slices.Clone(u.audio), whisper.SampleRate); err != nil {
+		log.Printf("Error saving training audio: %v", err)
+		return
+	}
+
+	fmt.Print("✏️  Correct output (Enter if it was right): ")
+	correction, err := stdin.ReadString('\n')
+	if err != nil && correction == "" {
+		log.Printf("Error reading correction: %v", err)
+	}
+	correction = strings.TrimRight(correction, "\r\n")
+	if correction == "" {
+		correction = output
+	}
+
+	entry := trainingEntry{
+		Time:          now,
+		Program:       activeApp,
+		BundleID:      bundleID,
+		Audio:         audio,
+		Transcription: transcription,
+		Output:        output,
+		Correction:    correction,
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "dataset.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Error opening training dataset: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		log.Printf("Error writing training dataset: %v", err)
+	}
+}
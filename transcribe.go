@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tmc/audioutil/whisperutil"
+	whispercpp "github.com/tmc/whisper.cpp/bindings/go"
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+// languageAuto is the language setting that detects the spoken language of each utterance.
+const languageAuto = "auto"
+
+// modelFetchRetries is the number of times a failed whisper model download is retried.
+const modelFetchRetries = 3
+
+// whisperModelPath returns the path of the named model as downloaded by whisperutil.WithAutoFetch.
+func whisperModelPath(name string) string {
+	dir, _ := os.UserCacheDir()
+	return filepath.Join(dir, whisperutil.CacheDirName, "ggml-"+name+".bin")
+}
+
+// whisperModelFile returns the path of the configured whisper model file.
+func (c RightHandConfig) whisperModelFile() string {
+	if c.WhisperModelPath != "" {
+		return c.WhisperModelPath
+	}
+	return whisperModelPath(c.WhisperModel)
+}
+
+// fetchWhisperModel returns the path of the whisper model to use, downloading
+// the configured model if needed. Failed downloads are retried with backoff;
+// if they keep failing, any other model already in the cache is used instead.
+func fetchWhisperModel(cfg RightHandConfig) (string, error) {
+	path := cfg.whisperModelFile()
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	} else if cfg.WhisperModelPath != "" {
+		return "", fmt.Errorf("whisper_model_path: %w", err)
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		_, err = whisperutil.GetModelPath(whisperutil.WithAutoFetch(), whisperutil.WithModelName(cfg.WhisperModel))
+		if err == nil {
+			return path, nil
+		}
+		os.Remove(path) // a partial download would be mistaken for the model next time
+		log.Printf("Error downloading whisper model %q (attempt %d): %v", cfg.WhisperModel, attempt+1, err)
+		if attempt == modelFetchRetries {
+			break
+		}
+		delay := time.Second << attempt
+		fmt.Printf("⚠️  Downloading whisper model failed, retrying in %v...\n", delay)
+		time.Sleep(delay)
+	}
+	cached, _ := filepath.Glob(whisperModelPath("*"))
+	if len(cached) > 0 {
+		fmt.Printf("⚠️  Could not download whisper model %q, using %s instead\n", cfg.WhisperModel, filepath.Base(cached[0]))
+		return cached[0], nil
+	}
+	return "", fmt.Errorf("downloading whisper model %q: %w (if you are offline, download ggml-%s.bin on another machine and set whisper_model_path to its location)", cfg.WhisperModel, err, cfg.WhisperModel)
+}
+
+// segmentTranscriber transcribes audio with the whisper bindings directly,
+// exposing the per-segment details that whisperaudio does not. It uses the
+// low-level bindings, whose context also detects the spoken language, so the
+// model is loaded only once.
+type segmentTranscriber struct {
+	modelPath string
+	ctx       *whispercpp.Context // nil once closed
+}
+
+// newSegmentTranscriber loads the whisper model at modelPath.
+func newSegmentTranscriber(modelPath string) (*segmentTranscriber, error) {
+	if _, err := os.Stat(modelPath); err != nil {
+		return nil, fmt.Errorf("loading whisper model: %w", err)
+	}
+	ctx := whispercpp.Whisper_init(modelPath)
+	if ctx == nil {
+		return nil, fmt.Errorf("loading whisper model %s", modelPath)
+	}
+	return &segmentTranscriber{modelPath: modelPath, ctx: ctx}, nil
+}
+
+// close frees the model. The transcriber can't be used afterwards.
+func (t *segmentTranscriber) close() {
+	if t.ctx != nil {
+		t.ctx.Whisper_free()
+		t.ctx = nil
+	}
+}
+
+// transcribe transcribes samples in the given language and returns the
+// recognized segments. An empty language uses the model's default.
+//
+// It also returns the confidence of the transcription: the average
+// probability of its text tokens, or 1 if there are none.
+//
+// A non-nil onWords is called with the words of each segment, with token
+// timestamps, as soon as whisper recognizes it.
+//
+// It uses the same parameters as whisper.Model.NewContext.
+func (t *segmentTranscriber) transcribe(samples []float32, language string, onWords func([]timedWord)) ([]whisper.Segment, float32, error) {
+	if len(samples) == 0 {
+		return nil, 1, nil
+	}
+	if t.ctx == nil {
+		return nil, 0, errors.New("whisper model is closed")
+	}
+	ctx := t.ctx
+	params := ctx.Whisper_full_default_params(whispercpp.SAMPLING_GREEDY)
+	params.SetTranslate(false)
+	params.SetPrintSpecial(false)
+	params.SetPrintProgress(false)
+	params.SetPrintRealtime(false)
+	params.SetPrintTimestamps(false)
+	params.SetThreads(runtime.NumCPU())
+	params.SetNoContext(true)
+	if language != "" {
+		if ctx.Whisper_is_multilingual() == 0 {
+			return nil, 0, fmt.Errorf("setting language %q: %w", language, whisper.ErrModelNotMultilingual)
+		}
+		id := ctx.Whisper_lang_id(language)
+		if id < 0 {
+			return nil, 0, fmt.Errorf("setting language %q: %w", language, whisper.ErrUnsupportedLanguage)
+		}
+		if err := params.SetLanguage(id); err != nil {
+			return nil, 0, fmt.Errorf("setting language %q: %w", language, err)
+		}
+	}
+	eot := ctx.Whisper_token_eot()
+	// special tokens follow the text tokens in the vocabulary
+	isText := func(token whisper.Token) bool { return whispercpp.Token(token.Id) < eot }
+	var onSegment func(int)
+	if onWords != nil {
+		params.SetTokenTimestamps(true)
+		params.SetSingleSegment(true)
+		onSegment = func(new int) {
+			for i := ctx.Whisper_full_n_segments() - new; i < ctx.Whisper_full_n_segments(); i++ {
+				onWords(segmentWords(rawSegment(ctx, i), isText))
+			}
+		}
+	}
+	if err := ctx.Whisper_full(params, samples, nil, onSegment, nil); err != nil {
+		return nil, 0, err
+	}
+	var (
+		segments []whisper.Segment
+		sum      float32
+		n        int
+	)
+	for i := 0; i < ctx.Whisper_full_n_segments(); i++ {
+		segment := rawSegment(ctx, i)
+		for _, token := range segment.Tokens {
+			if isText(token) {
+				sum += token.P
+				n++
+			}
+		}
+		segments = append(segments, segment)
+	}
+	if n == 0 {
+		return segments, 1, nil
+	}
+	return segments, sum / float32(n), nil
+}
+
+// rawSegment returns segment i of the last transcription with the low-level bindings.
+func rawSegment(ctx *whispercpp.Context, i int) whisper.Segment {
+	segment := whisper.Segment{
+		Num:   i,
+		Text:  strings.TrimSpace(ctx.Whisper_full_get_segment_text(i)),
+		Start: time.Duration(ctx.Whisper_full_get_segment_t0(i)) * 10 * time.Millisecond,
+		End:   time.Duration(ctx.Whisper_full_get_segment_t1(i)) * 10 * time.Millisecond,
+	}
+	for j := 0; j < ctx.Whisper_full_n_tokens(i); j++ {
+		data := ctx.Whisper_full_get_token_data(i, j)
+		segment.Tokens = append(segment.Tokens, whisper.Token{
+			Id:    int(ctx.Whisper_full_get_token_id(i, j)),
+			Text:  ctx.Whisper_full_get_token_text(i, j),
+			P:     ctx.Whisper_full_get_token_p(i, j),
+			Start: time.Duration(data.T0()) * 10 * time.Millisecond,
+			End:   time.Duration(data.T1()) * 10 * time.Millisecond,
+		})
+	}
+	return segment
+}
+
+// timedWord is a word of a transcription and when it starts in the recording.
+type timedWord struct {
+	text  string
+	start time.Duration
+}
+
+// segmentWords returns the words of segment with their start times, joining
+// the text tokens of each word. Without token timestamps, it falls back to the
+// whole segment as one word starting when the segment does.
+func segmentWords(segment whisper.Segment, isText func(whisper.Token) bool) []timedWord {
+	var (
+		words []timedWord
+		timed bool
+	)
+	for _, token := range segment.Tokens {
+		if !isText(token) {
+			continue
+		}
+		timed = timed || token.End > 0
+		if len(words) == 0 || strings.HasPrefix(token.Text, " ") {
+			words = append(words, timedWord{start: token.Start})
+		}
+		words[len(words)-1].text += strings.TrimSpace(token.Text)
+	}
+	if !timed {
+		return []timedWord{{text: segment.Text, start: segment.Start}}
+	}
+	return words
+}
+
+// detectLanguage returns the language most likely spoken in samples, such as "en" or "de".
+func (t *segmentTranscriber) detectLanguage(samples []float32) (string, error) {
+	if len(samples) == 0 {
+		return "", errors.New("no audio")
+	}
+	if t.ctx == nil {
+		return "", errors.New("whisper model is closed")
+	}
+	ctx := t.ctx
+	threads := runtime.NumCPU()
+	if err := ctx.Whisper_pcm_to_mel(samples, threads); err != nil {
+		return "", err
+	}
+	probs, err := ctx.Whisper_lang_auto_detect(0, threads)
+	if err != nil {
+		return "", err
+	}
+	best := 0
+	for id, p := range probs {
+		if p > probs[best] {
+			best = id
+		}
+	}
+	return whispercpp.Whisper_lang_str(best), nil
+}
+
+// segmentsText joins the text of segments.
+func segmentsText(segments []whisper.Segment) string {
+	texts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		texts = append(texts, strings.TrimSpace(segment.Text))
+	}
+	return strings.Join(texts, " ")
+}
+
+// transcribe transcribes audio. In verbose mode the per-segment timestamps
+// are printed as well, and with show_words each word is printed as it is
+// recognized; the returned text is the same either way.
+//
+// With min_confidence set, transcriptions less confident than that are
+// dropped, and an empty text is returned.
+//
+// With a language configured, audio is transcribed in that language. With
+// "auto", the spoken language is detected first and recorded for handleText.
+//
+// A non-empty model names a whisper model to use instead of the configured
+// one, which is loaded on first use.
+func (app *App) transcribe(audio []float32, model string) (string, error) {
+	cfg := app.config()
+	t := app.segments
+	if model != "" {
+		var err error
+		if t, err = app.modelTranscriber(model); err != nil {
+			return "", err
+		}
+		app.verbosef("transcribing with whisper model %q", model)
+	}
+	language := cfg.Language
+	if language == languageAuto {
+		detected, err := t.detectLanguage(audio)
+		if err != nil {
+			log.Printf("Error detecting language: %v", err) // whisper detects it again while transcribing
+		} else {
+			fmt.Printf("🌐 Detected language: %s\n", detected)
+			log.Printf("Detected language: %s", detected)
+			language = detected
+			app.language.Store(detected)
+		}
+	}
+	var onWords func([]timedWord)
+	if cfg.ShowWords {
+		var heard []string
+		onWords = func(words []timedWord) {
+			var b strings.Builder
+			for _, w := range words {
+				fmt.Fprintf(&b, " %s (%.1fs)", w.text, w.start.Seconds())
+				heard = append(heard, w.text)
+			}
+			fmt.Printf("🗣️ %s\n", b.String())
+			app.status.setTranscription(strings.Join(heard, " "))
+		}
+	}
+	segments, confidence, err := t.transcribe(audio, language, onWords)
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range segments {
+		app.verbosef("segment %d [%v → %v]: %q", segment.Num, segment.Start, segment.End, segment.Text)
+	}
+	text := segmentsText(segments)
+	app.verbosef("transcription confidence %.2f", confidence)
+	if confidence < cfg.MinConfidence {
+		fmt.Printf("🤷 Didn't catch that (confidence %.2f is below %.2f)\n", confidence, cfg.MinConfidence)
+		log.Printf("Ignoring %q: confidence %.2f is below min_confidence %.2f", text, confidence, cfg.MinConfidence)
+		return "", nil
+	}
+	return text, nil
+}
+
+// modelTranscriber returns the transcriber for the named whisper model,
+// downloading and loading the model on first use. It is only used by
+// processUtterances.
+func (app *App) modelTranscriber(model string) (*segmentTranscriber, error) {
+	if t, ok := app.transcribers[model]; ok {
+		return t, nil
+	}
+	cfg := *app.config()
+	cfg.WhisperModel = model
+	cfg.WhisperModelPath = ""
+	fmt.Printf("Loading whisper model %q...\n", model)
+	path, err := fetchWhisperModel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newSegmentTranscriber(path)
+	if err != nil {
+		return nil, err
+	}
+	if app.transcribers == nil {
+		app.transcribers = make(map[string]*segmentTranscriber)
+	}
+	app.transcribers[model] = t
+	return t, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestTranscribeKeepsLanguageWhenDetectionFails(t *testing.T) {
+	app := newTestApp(RightHandConfig{Language: languageAuto}, &fakeLLM{}, &recordingExecutor{})
+	app.segments = &segmentTranscriber{} // no audio is transcribed without a model
+	app.language.Store("de")
+	// detecting the language of no audio fails
+	if _, err := app.transcribe(nil, ""); err != nil {
+		t.Fatalf("transcribe error: %v", err)
+	}
+	if got, _ := app.language.Load().(string); got != "de" {
+		t.Errorf("language after failed detection = %q, want %q", got, "de")
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// keyTapPattern is a package-level compiled regular expression
+//
+// This regex is used to parse commands involving key presses.
+// The pattern:
+// 1. "\{" matches the literal opening brace
+// 2. "((?:[^\\}]+\\+)*[^\\}]+)" matches one or more modifiers, each followed by a '+', except for the last one
+// 3. "\\}" matches the literal closing brace
+// 4. "(?:\\+(\\{[A-Za-z1-9]+\\}|[A-Za-z1-9]+))?" optionally matches a key press preceded by a '+',
+// either a sequence of letters and digits or a key name in braces, as in {Command}+{Tab}
+// 5. "(?:\\[(\\d+)\\])?" optionally matches a pause in milliseconds to wait after the key press
+//
+// A separator after the chord, such as a space, is dropped by chordEnd.
+var keyTapPattern = regexp.MustCompile(`\{((?:[^\}]+\+)*[^\}]+)\}(?:\+(\{[A-Za-z1-9]+\}|[A-Za-z1-9]+))?(?:\[(\d+)\])?`)
+
+// chordSeparators is the chord_separators config setting. It is nil until
+// setChordSeparators is called.
+var chordSeparators atomic.Pointer[string]
+
+// setChordSeparators sets the characters dropped after a chord, for the
+// chords typed from now on; "" selects DefaultChordSeparators.
+func setChordSeparators(separators string) {
+	if separators == "" {
+		separators = DefaultChordSeparators
+	}
+	chordSeparators.Store(&separators)
+}
+
+// chordEnd returns the index in text at which typing resumes after a chord
+// ending at end: past one separator, such as a space or period, if one
+// follows the chord, and at end otherwise.
+func chordEnd(text string, end int) int {
+	separators := DefaultChordSeparators
+	if s := chordSeparators.Load(); s != nil {
+		separators = *s
+	}
+	if r, size := utf8.DecodeRuneInString(text[end:]); size > 0 && strings.ContainsRune(separators, r) {
+		return end + size
+	}
+	return end
+}
+
+// Doubled braces, as in "func main() {{ }}", stand for literal braces rather
+// than chords. escapeBraces hides them from keyTapPattern as private-use
+// characters, which unescapeBraces turns into single braces for typing.
+var (
+	escapeBraces   = strings.NewReplacer("{{", "\uE000", "}}", "\uE001").Replace
+	unescapeBraces = strings.NewReplacer("\uE000", "{", "\uE001", "}").Replace
+)
+
+// Helper function to simulate key tapping with given modifiers and key
+func keyTapWithModifiers(modifiers []any, key string) {
+	robotgo.KeySleep = 100
+	robotgo.KeyTap(key, modifiers...)
+	robotgo.KeyTap("shift")            // undo modifiers
+	time.Sleep(100 * time.Millisecond) // slight delay to allow for key press to register
+}
+
+// modifierMap maps the names of modifiers used in chords to their representation for robotgo.
+var modifierMap = map[string]string{
+	"Command": "command",
+	"Shift":   "shift",
+	"Option":  "alt",
+	"Control": "ctrl",
+}
+
+// keyNameMap maps the names of standalone keys used in chords, such as
+// {Tab}, to their representation for robotgo.
+var keyNameMap = map[string]string{
+	"Tab":    "tab",
+	"Enter":  "enter",
+	"Escape": "escape",
+}
+
+// chordNames are the modifier and key names chords can use.
+type chordNames struct {
+	modifiers map[string]string
+	keys      map[string]string
+}
+
+// keyMap is modifierMap and keyNameMap with the key_map config setting
+// merged over them. It is nil until setKeyMap is called.
+var keyMap atomic.Pointer[chordNames]
+
+// setKeyMap merges custom over modifierMap and keyNameMap for the chords
+// typed from now on. Names mapped to a robotgo modifier are modifiers; all
+// others are keys.
+func setKeyMap(custom map[string]string) {
+	names := chordNames{modifiers: maps.Clone(modifierMap), keys: maps.Clone(keyNameMap)}
+	for name, key := range custom {
+		if isModifier(key) {
+			names.modifiers[name] = key
+			delete(names.keys, name)
+		} else {
+			names.keys[name] = key
+			delete(names.modifiers, name)
+		}
+	}
+	keyMap.Store(&names)
+}
+
+// isModifier reports whether key is the robotgo name of a modifier.
+func isModifier(key string) bool {
+	for _, m := range modifierMap {
+		if m == key {
+			return true
+		}
+	}
+	return false
+}
+
+// currentChordNames returns the names chords can use, including key_map.
+func currentChordNames() chordNames {
+	if names := keyMap.Load(); names != nil {
+		return *names
+	}
+	return chordNames{modifiers: modifierMap, keys: keyNameMap}
+}
+
+// lookupKey returns the robotgo name of the key called name in chords.
+func lookupKey(name string) (string, bool) {
+	key, ok := currentChordNames().keys[name]
+	return key, ok
+}
+
+// lookupModifier returns the robotgo name of the modifier called name in chords.
+func lookupModifier(name string) (string, bool) {
+	modifier, ok := currentChordNames().modifiers[name]
+	return modifier, ok
+}
+
+// extractModifiersAndKeyFromMatch returns the robotgo modifiers and key of
+// the chord matched by keyTapPattern. The key is the one after the braces,
+// as in {Command}+t or {Command}+{Tab}, or else the last name in them, as in
+// {Command+Tab} or {Tab}. A chord of modifiers only, such as {Command},
+// presses the last of them.
+func extractModifiersAndKeyFromMatch(text string, match []int) ([]string, string) {
+	// Extract the modifier keys
+	modifierKeys := strings.Split(text[match[2]:match[3]], "+")
+	modifiers := make([]string, 0, len(modifierKeys))
+	key := ""
+
+	// see if we have a key (check index 4)
+	if match[4] != -1 {
+		key = text[match[4]:match[5]]
+		if name, ok := strings.CutPrefix(key, "{"); ok {
+			key, _ = lookupKey(strings.TrimSuffix(name, "}"))
+		}
+	} else {
+		last := modifierKeys[len(modifierKeys)-1]
+		var ok bool
+		if key, ok = lookupKey(last); !ok {
+			key, _ = lookupModifier(last)
+		}
+		modifierKeys = modifierKeys[:len(modifierKeys)-1] // Remove the last element (the key)
+	}
+
+	for _, modifier := range modifierKeys {
+		modifierKey, exists := lookupModifier(modifier)
+		if !exists {
+			log.Printf("Unknown modifier: %s", modifier)
+			continue
+		}
+		modifiers = append(modifiers, modifierKey)
+	}
+
+	//fmt.Fprintln(os.Stderr, "righthand: modifiers:", modifiers, "key:", key)
+	return modifiers, key
+}
+
+// chordProblems returns a description of each chord in text that
+// extractModifiersAndKeyFromMatch cannot turn into a key press, such as one
+// with a misspelled modifier, or that the named executor cannot press.
+func chordProblems(text, executor string) []string {
+	text = escapeBraces(text)
+	var problems []string
+	for _, match := range keyTapPattern.FindAllStringSubmatchIndex(text, -1) {
+		chord := text[match[0]:match[1]]
+		names := strings.Split(text[match[2]:match[3]], "+")
+		if match[4] == -1 {
+			// the last name is the key, as in {Command+Enter}, or a lone modifier
+			last := names[len(names)-1]
+			names = names[:len(names)-1]
+			_, key := lookupKey(last)
+			_, modifier := lookupModifier(last)
+			if !key && !modifier {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %q", chord, last))
+			}
+		} else if key := text[match[4]:match[5]]; strings.HasPrefix(key, "{") {
+			if _, ok := lookupKey(strings.Trim(key, "{}")); !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %q", chord, strings.Trim(key, "{}")))
+			}
+		} else if len(key) > 1 {
+			if !executorHasKey(executor, key) {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %q", chord, key))
+			}
+		}
+		for _, name := range names {
+			if _, ok := lookupModifier(name); ok {
+				continue
+			}
+			if _, ok := lookupKey(name); ok {
+				problems = append(problems, fmt.Sprintf("%s: %q is a key, not a modifier; put it last", chord, name))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s: unknown modifier %q", chord, name))
+			}
+		}
+	}
+	return problems
+}
+
+// typingCancelledError is returned by simulateTyping when its context is cancelled.
+type typingCancelledError struct {
+	err   error
+	typed int // number of text segments typed before cancellation
+}
+
+func (e *typingCancelledError) Error() string {
+	return fmt.Sprintf("typing cancelled after %d segments: %v", e.typed, e.err)
+}
+
+func (e *typingCancelledError) Unwrap() error { return e.err }
+
+// affixes is text typed before and after output, such as Markdown quote
+// delimiters. Affixes are typed as is, without interpreting chords.
+type affixes struct {
+	prefix string
+	suffix string
+}
+
+// around types a.prefix, then runs typing, then types a.suffix.
+func (a affixes) around(exec Executor, typing func() error) error {
+	if a.prefix != "" {
+		if err := exec.Type(a.prefix); err != nil {
+			return err
+		}
+	}
+	if err := typing(); err != nil {
+		var cancelled *typingCancelledError
+		if a.prefix != "" && errors.As(err, &cancelled) {
+			cancelled.typed++ // undo the prefix too
+		}
+		return err
+	}
+	if a.suffix != "" {
+		return exec.Type(a.suffix)
+	}
+	return nil
+}
+
+// undoTyping issues an undo for each of the n text segments already typed.
+func undoTyping(exec Executor, n int) {
+	for i := 0; i < n; i++ {
+		exec.KeyTap("z", "command")
+	}
+}
+
+// simulateTyping types text with exec, interpreting {...} chords as key presses.
+// Newlines in the text between chords are entered according to newlines, a
+// newline_mode setting. It stops between steps once ctx is cancelled.
+func simulateTyping(ctx context.Context, exec Executor, text, newlines string) error {
+	text = escapeBraces(text)
+	matches := keyTapPattern.FindAllStringSubmatchIndex(text, -1)
+
+	lastIndex := 0
+	typed := 0
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return &typingCancelledError{err: err, typed: typed}
+		}
+		// Type the text before the match as normal
+		if lastIndex != match[0] {
+			segment := unescapeBraces(text[lastIndex:match[0]])
+			fmt.Fprintln(os.Stderr, "righthand: typing text:", segment)
+			if err := typeLines(exec, segment, newlines); err != nil {
+				return err
+			}
+			typed++
+		}
+		lastIndex = chordEnd(text, match[1])
+
+		modifiers, key := extractModifiersAndKeyFromMatch(text, match)
+
+		// Simulate key press
+		if err := exec.KeyTap(key, modifiers...); err != nil {
+			return err
+		}
+
+		// Pause after the key press if requested, e.g. {Command}+t[300]
+		if match[6] != -1 {
+			ms, _ := strconv.Atoi(text[match[6]:match[7]])
+			select {
+			case <-time.After(time.Duration(ms) * time.Millisecond):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	// Type the rest of the text after the last match
+	if lastIndex < len(text) {
+		if err := ctx.Err(); err != nil {
+			return &typingCancelledError{err: err, typed: typed}
+		}
+		segment := unescapeBraces(text[lastIndex:])
+		fmt.Fprintln(os.Stderr, "righthand: typing remainder of text:", segment)
+		time.Sleep(100 * time.Millisecond) // slight delay to allow for key press to registerV
+		return typeLines(exec, segment, newlines)
+	}
+	return nil
+}
+
+// typeLines types text with exec, entering its newlines according to newlines:
+// typed as is (newlineLiteral or ""), pressed as Enter, or dropped.
+func typeLines(exec Executor, text, newlines string) error {
+	switch newlines {
+	case newlineStrip:
+		if text = strings.ReplaceAll(text, "\n", ""); text == "" {
+			return nil
+		}
+	case newlineEnter:
+		for i, line := range strings.Split(text, "\n") {
+			if i > 0 {
+				if err := exec.KeyTap("enter"); err != nil {
+					return err
+				}
+			}
+			if line == "" {
+				continue
+			}
+			if err := exec.Type(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return exec.Type(text)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestChordProblems(t *testing.T) {
+	setKeyMap(nil)
+	tests := []struct {
+		text     string
+		executor string
+		want     []string // substrings of the problems, in order
+	}{
+		{text: "{Command}+t", executor: executorRobotgo},
+		{text: "{Command}+home {Shift}+end {Control}+pageup", executor: executorRobotgo},
+		{text: "{Option}+f13", executor: ""},
+		{text: "{Command}+home", executor: executorAppleScript, want: []string{`unknown key "home"`}},
+		{text: "{Command}+left", executor: executorAppleScript},
+		{text: "{Command}+hoem", executor: executorRobotgo, want: []string{`unknown key "hoem"`}},
+		{text: "{Comand}+t", executor: executorRobotgo, want: []string{`unknown modifier "Comand"`}},
+		{text: "{Tab+Command}", executor: executorRobotgo, want: []string{`"Tab" is a key`}},
+		{text: "func main() {{ }}", executor: executorRobotgo},
+	}
+	for _, tt := range tests {
+		got := chordProblems(tt.text, tt.executor)
+		if len(got) != len(tt.want) {
+			t.Errorf("chordProblems(%q, %q) = %q, want %d problems", tt.text, tt.executor, got, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("chordProblems(%q, %q)[%d] = %q, want it to contain %q", tt.text, tt.executor, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestSimulateTyping(t *testing.T) {
+	setKeyMap(nil)
+	t.Cleanup(func() { setChordSeparators("") })
+	tests := []struct {
+		text       string
+		separators string // chord_separators; "" is the default
+		want       []string
+	}{
+		{text: "hello", want: []string{"type hello"}},
+		{text: "{Command}+t", want: []string{"key command+t"}},
+		{text: "{Tab}", want: []string{"key tab"}},
+		{text: "{Command}+{Tab}", want: []string{"key command+tab"}},
+		{text: "{Command+Tab}", want: []string{"key command+tab"}},
+		{text: "{Command}+{Tab}[1]x", want: []string{"key command+tab", "type x"}},
+
+		// literal braces
+		{text: "func main() {{ }}", want: []string{"type func main() { }"}},
+		{text: "{{a}} {Command}+t", want: []string{"type {a} ", "key command+t"}},
+		{text: "{Command}+s then {{done}}", want: []string{"key command+s", "type then {done}"}},
+		{text: "{{Command}}+t", want: []string{"type {Command}+t"}},
+
+		// punctuation after a chord
+		{text: "{Command}+t.", want: []string{"key command+t"}},
+		{text: "{Command}+t, hello", want: []string{"key command+t", "type  hello"}},
+		{text: "{Command}+t;ls", want: []string{"key command+t", "type ls"}},
+		{text: "{Command}+t\nls", want: []string{"key command+t", "type ls"}},
+		{text: "{Command}+t  ls", want: []string{"key command+t", "type  ls"}},
+		{text: "{Command}+t!", want: []string{"key command+t", "type !"}},
+		{text: "{Command}+t|x", separators: "|", want: []string{"key command+t", "type x"}},
+		{text: "{Command}+t x", separators: "|", want: []string{"key command+t", "type  x"}},
+	}
+	for _, tt := range tests {
+		setChordSeparators(tt.separators)
+		exec := &recordingExecutor{}
+		if err := simulateTyping(context.Background(), exec, tt.text, newlineLiteral); err != nil {
+			t.Errorf("simulateTyping(%q) error: %v", tt.text, err)
+			continue
+		}
+		if got := exec.recorded(); !slices.Equal(got, tt.want) {
+			t.Errorf("simulateTyping(%q) with separators %q typed %q, want %q", tt.text, tt.separators, got, tt.want)
+		}
+	}
+}
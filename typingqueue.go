@@ -0,0 +1,56 @@
+package main
+
+import "sync"
+
+// typingQueue lets commands type one at a time, in the order they were started,
+// so the output of overlapping commands doesn't interleave.
+type typingQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	next     uint64          // next ticket to hand out
+	serving  uint64          // ticket whose turn it is to type
+	finished map[uint64]bool // tickets done out of turn
+}
+
+func newTypingQueue() *typingQueue {
+	q := &typingQueue{finished: make(map[uint64]bool)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// ticket returns a place in the queue. Every ticket must be released with done.
+func (q *typingQueue) ticket() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := q.next
+	q.next++
+	return t
+}
+
+// wait blocks until it is t's turn to type.
+func (q *typingQueue) wait(t uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.serving != t {
+		q.cond.Wait()
+	}
+}
+
+// ahead returns the number of unfinished commands ahead of t.
+func (q *typingQueue) ahead(t uint64) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(t - q.serving)
+}
+
+// done releases t, letting the next command type.
+func (q *typingQueue) done(t uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.finished[t] = true
+	for q.finished[q.serving] {
+		delete(q.finished, q.serving)
+		q.serving++
+	}
+	q.cond.Broadcast()
+}
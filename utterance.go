@@ -0,0 +1,57 @@
+package main
+
+import "log"
+
+// utterance is the audio of a command, recorded in one or more listening
+// sessions, waiting to be transcribed and handled.
+type utterance struct {
+	audio     []float32
+	sessions  int                // listening sessions combined by coalesce_window
+	recording *recoveryRecording // nil unless crash_recovery is set
+
+	// with capture_app_at: start, the frontmost app when listening started
+	activeApp string
+	bundleID  string
+
+	intent string // the intent whose hotkey started the utterance, if any
+	retry  bool   // transcribe with retry_whisper_model, for retry_hotkey
+
+	session int64 // number of the latest listening session in it, for supersede_in_flight
+}
+
+// newUtterance starts an utterance for the given intent, looking up the
+// frontmost app and starting a recovery recording if so configured.
+func (app *App) newUtterance(intent string) *utterance {
+	cfg := app.config()
+	u := &utterance{intent: intent}
+	if cfg.CaptureAppAt == captureAppAtStart {
+		u.activeApp, u.bundleID = frontmostApp()
+	}
+	if cfg.CrashRecovery {
+		var err error
+		if u.recording, err = createRecoveryRecording(); err != nil {
+			log.Printf("Error creating recovery recording: %v", err)
+		}
+	}
+	return u
+}
+
+// add appends captured audio to the utterance and its recovery recording.
+func (u *utterance) add(samples []float32) {
+	u.audio = append(u.audio, samples...)
+	if err := u.recording.write(samples); err != nil {
+		log.Printf("Error writing recovery recording: %v", err)
+	}
+}
+
+// discard removes the utterance's recovery recording once it is no longer
+// needed. It does nothing if u is nil.
+func (u *utterance) discard() {
+	if u == nil {
+		return
+	}
+	if err := u.recording.remove(); err != nil {
+		log.Printf("Error removing recovery recording: %v", err)
+	}
+	u.recording = nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set with -ldflags, for example:
+//
+//	go build -ldflags "-X main.version=v0.2.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+var (
+	version = "devel"
+	commit  = ""
+	date    = ""
+)
+
+// versionDeps are the modules whose versions are printed by -version.
+var versionDeps = []string{
+	"github.com/tmc/whisper.cpp/bindings/go",
+	"github.com/tmc/langchaingo",
+}
+
+// printVersion prints the version and build information of RightHand and
+// of the dependencies most relevant to bug reports.
+func printVersion() {
+	info, ok := debug.ReadBuildInfo()
+	if ok && version == "devel" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	if ok {
+		// fall back to the version control information recorded by go build
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == "":
+				commit = setting.Value
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+	fmt.Println("righthand", version)
+	if commit != "" {
+		fmt.Println("  commit", commit)
+	}
+	if date != "" {
+		fmt.Println("  built ", date)
+	}
+	fmt.Println("  go    ", runtime.Version(), runtime.GOOS+"/"+runtime.GOARCH)
+	if !ok {
+		return
+	}
+	for _, dep := range info.Deps {
+		for _, path := range versionDeps {
+			if dep.Path != path {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			fmt.Println("  dep   ", dep.Path, dep.Version)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/tmc/audioutil/wavutil"
+	"github.com/tmc/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+// wavHeaderSize is the size of the header written by appendWAVHeader.
+const wavHeaderSize = 44
+
+// appendWAVHeader appends the header of a mono WAV file at the whisper sample
+// rate to b. format is 1 for integer PCM or 3 for IEEE float, and dataSize is
+// the size of the samples that follow, in bytes; math.MaxUint32 marks it as
+// unknown, as for streamed data.
+func appendWAVHeader(b []byte, format, bits uint16, dataSize uint32) []byte {
+	riffSize := uint32(math.MaxUint32)
+	if dataSize != math.MaxUint32 {
+		riffSize = wavHeaderSize - 8 + dataSize
+	}
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, riffSize)
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, format)
+	b = binary.LittleEndian.AppendUint16(b, 1) // mono
+	b = binary.LittleEndian.AppendUint32(b, uint32(whisper.SampleRate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(whisper.SampleRate)*uint32(bits/8))
+	b = binary.LittleEndian.AppendUint16(b, bits/8)
+	b = binary.LittleEndian.AppendUint16(b, bits)
+	b = append(b, "data"...)
+	return binary.LittleEndian.AppendUint32(b, dataSize)
+}
+
+// saveWAV saves samples to a mono WAV file at the whisper sample rate,
+// encoded as format, a dump_wav_format setting.
+func saveWAV(path string, samples []float32, format string) error {
+	var b []byte
+	switch format {
+	case "", wavFormatPCM24:
+		return wavutil.SaveWAV(path, samples, whisper.SampleRate)
+	case wavFormatPCM16:
+		b = appendWAVHeader(make([]byte, 0, wavHeaderSize+len(samples)*2), 1, 16, uint32(len(samples)*2))
+		for _, s := range samples {
+			s = max(-1, min(s, 1)) // clip rather than wrap around
+			b = binary.LittleEndian.AppendUint16(b, uint16(int16(math.Round(float64(s)*math.MaxInt16))))
+		}
+	case wavFormatFloat32:
+		b = appendWAVHeader(make([]byte, 0, wavHeaderSize+len(samples)*4), 3, 32, uint32(len(samples)*4))
+		for _, s := range samples {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(s))
+		}
+	default:
+		return fmt.Errorf("unknown dump_wav_format %q", format)
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// readWAV reads a WAV file of 16-, 24-, or 32-bit integer or 32-bit float
+// samples at the whisper sample rate, mixing multiple channels down to mono.
+// A data chunk whose size runs past the end of the file, as in a recording
+// that was never finished, is read up to the end of the file.
+func readWAV(path string) ([]float32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	var format, channels, bits uint16
+	var rate uint32
+	for chunk := data[12:]; len(chunk) >= 8; {
+		id, size := string(chunk[0:4]), binary.LittleEndian.Uint32(chunk[4:8])
+		body := chunk[8:]
+		if uint64(size) < uint64(len(body)) {
+			body = body[:size]
+		}
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, errors.New("invalid WAV format chunk")
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = binary.LittleEndian.Uint16(body[2:4])
+			rate = binary.LittleEndian.Uint32(body[4:8])
+			bits = binary.LittleEndian.Uint16(body[14:16])
+		case "data":
+			if channels == 0 {
+				return nil, errors.New("WAV data before format chunk")
+			}
+			if rate != uint32(whisper.SampleRate) {
+				return nil, fmt.Errorf("WAV sample rate is %d Hz, not %d Hz; convert it first, e.g. with ffmpeg -ar %d", rate, whisper.SampleRate, whisper.SampleRate)
+			}
+			return decodeSamples(body, format, channels, bits)
+		}
+		next := 8 + len(body) + len(body)%2 // chunks are padded to an even size
+		if next > len(chunk) {
+			break
+		}
+		chunk = chunk[next:]
+	}
+	return nil, errors.New("WAV file has no data")
+}
+
+// decodeSamples decodes interleaved PCM data into mono samples.
+func decodeSamples(data []byte, format, channels, bits uint16) ([]float32, error) {
+	var (
+		size   int
+		sample func([]byte) float32
+	)
+	switch {
+	case format == 1 && bits == 16: // integer PCM
+		size = 2
+		sample = func(b []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case format == 1 && bits == 24:
+		size = 3
+		sample = func(b []byte) float32 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8 // sign-extend
+			return float32(v) / 8388608
+		}
+	case format == 1 && bits == 32:
+		size = 4
+		sample = func(b []byte) float32 { return float32(int32(binary.LittleEndian.Uint32(b))) / 2147483648 }
+	case format == 3 && bits == 32: // IEEE float
+		size = 4
+		sample = func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }
+	default:
+		return nil, fmt.Errorf("unsupported WAV encoding (format %d, %d bits); use 16-, 24-, or 32-bit PCM or 32-bit float", format, bits)
+	}
+	frame := size * int(channels)
+	samples := make([]float32, len(data)/frame) // a partially written frame is dropped
+	for i := range samples {
+		var sum float32
+		for c := 0; c < int(channels); c++ {
+			sum += sample(data[i*frame+c*size:])
+		}
+		samples[i] = sum / float32(channels)
+	}
+	return samples, nil
+}
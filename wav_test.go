@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadWAV(t *testing.T) {
+	want := []float32{0, 0.5, -0.5, 0.25, -1}
+	pcm := func(bits uint16, scale float64) []byte {
+		b := appendWAVHeader(nil, 1, bits, uint32(len(want))*uint32(bits/8))
+		for _, s := range want {
+			v := uint32(int32(math.Round(float64(s) * scale)))
+			b = append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+			b = b[:len(b)-4+int(bits/8)]
+		}
+		return b
+	}
+	float := appendWAVHeader(nil, 3, 32, uint32(len(want))*4)
+	for _, s := range want {
+		float = binary.LittleEndian.AppendUint32(float, math.Float32bits(s))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"pcm16", pcm(16, 1<<15)},
+		{"pcm24", pcm(24, 1<<23)},
+		{"pcm32", pcm(32, 1<<31)},
+		{"float32", float},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.name+".wav")
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readWAV(path)
+		if err != nil {
+			t.Errorf("%s: readWAV error: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: readWAV returned %d samples, want %d", tt.name, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if math.Abs(float64(got[i]-want[i])) > 1e-6 {
+				t.Errorf("%s: sample %d = %v, want %v", tt.name, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestSaveWAV(t *testing.T) {
+	samples := []float32{0, 0.5, -0.5, 1, -1}
+	for _, format := range []string{wavFormatPCM16, wavFormatFloat32} {
+		path := filepath.Join(t.TempDir(), "out.wav")
+		if err := saveWAV(path, samples, format); err != nil {
+			t.Fatalf("saveWAV(%s) error: %v", format, err)
+		}
+		got, err := readWAV(path)
+		if err != nil {
+			t.Fatalf("readWAV of %s error: %v", format, err)
+		}
+		if len(got) != len(samples) {
+			t.Fatalf("readWAV of %s returned %d samples, want %d", format, len(got), len(samples))
+		}
+		for i := range samples {
+			if math.Abs(float64(got[i]-samples[i])) > 1e-4 {
+				t.Errorf("%s: sample %d = %v, want %v", format, i, got[i], samples[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// defaultWebhookTimeout is the timeout for each webhook request if none is configured.
+const defaultWebhookTimeout = 5 * time.Second
+
+// WebhookConfig configures a webhook notified of each executed command.
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Timeout time.Duration     `json:"timeout"` // per request, e.g. "5s"
+	Retries int               `json:"retries"` // additional attempts after a failure
+}
+
+// postWebhook posts entry as JSON to the webhook, retrying failures with backoff.
+// It is meant to be run in its own goroutine; failures are logged.
+func postWebhook(ctx context.Context, hook WebhookConfig, entry commandLogEntry) {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding webhook payload: %v", err)
+		return
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err = sendWebhook(ctx, hook, body, timeout); err == nil {
+			return
+		}
+	}
+	log.Printf("Error posting to webhook after %d attempts: %v", hook.Retries+1, err)
+}
+
+func sendWebhook(ctx context.Context, hook WebhookConfig, body []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework ApplicationServices -framework CoreFoundation
+#include <ApplicationServices/ApplicationServices.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+// listWindows writes a "pid\ttitle\n" line for each on-screen application window to buf.
+// It returns the number of bytes written.
+static int listWindows(char *buf, int len) {
+	CFArrayRef windows = CGWindowListCopyWindowInfo(kCGWindowListOptionOnScreenOnly | kCGWindowListExcludeDesktopElements, kCGNullWindowID);
+	if (windows == NULL) {
+		return 0;
+	}
+	int n = 0;
+	char title[512];
+	for (CFIndex i = 0; i < CFArrayGetCount(windows); i++) {
+		CFDictionaryRef w = CFArrayGetValueAtIndex(windows, i);
+		CFNumberRef layerRef = CFDictionaryGetValue(w, kCGWindowLayer);
+		CFNumberRef pidRef = CFDictionaryGetValue(w, kCGWindowOwnerPID);
+		CFStringRef nameRef = CFDictionaryGetValue(w, kCGWindowName);
+		int layer = 0, pid = 0;
+		if (layerRef != NULL) {
+			CFNumberGetValue(layerRef, kCFNumberIntType, &layer);
+		}
+		if (layer != 0 || pidRef == NULL || nameRef == NULL) {
+			continue;
+		}
+		CFNumberGetValue(pidRef, kCFNumberIntType, &pid);
+		if (!CFStringGetCString(nameRef, title, sizeof(title), kCFStringEncodingUTF8)) {
+			continue;
+		}
+		int m = snprintf(buf + n, len - n, "%d\t%s\n", pid, title);
+		if (m < 0 || m >= len - n) {
+			break;
+		}
+		n += m;
+	}
+	CFRelease(windows);
+	return n;
+}
+
+// raiseWindow raises the window of process pid with the given title using the accessibility API.
+static int raiseWindow(int pid, const char *title) {
+	AXUIElementRef app = AXUIElementCreateApplication(pid);
+	CFArrayRef windows = NULL;
+	int raised = 0;
+	if (AXUIElementCopyAttributeValue(app, kAXWindowsAttribute, (CFTypeRef *)&windows) == kAXErrorSuccess && windows != NULL) {
+		CFStringRef want = CFStringCreateWithCString(NULL, title, kCFStringEncodingUTF8);
+		for (CFIndex i = 0; i < CFArrayGetCount(windows) && !raised; i++) {
+			AXUIElementRef w = (AXUIElementRef)CFArrayGetValueAtIndex(windows, i);
+			CFStringRef t = NULL;
+			if (AXUIElementCopyAttributeValue(w, kAXTitleAttribute, (CFTypeRef *)&t) != kAXErrorSuccess || t == NULL) {
+				continue;
+			}
+			if (CFStringCompare(t, want, 0) == kCFCompareEqualTo) {
+				AXUIElementSetAttributeValue(w, kAXMainAttribute, kCFBooleanTrue);
+				raised = AXUIElementPerformAction(w, kAXRaiseAction) == kAXErrorSuccess;
+			}
+			CFRelease(t);
+		}
+		CFRelease(want);
+		CFRelease(windows);
+	}
+	CFRelease(app);
+	return raised;
+}
+*/
+import "C"
+
+import (
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// window is an on-screen application window.
+type window struct {
+	PID   int
+	Title string
+}
+
+// listWindows returns the on-screen application windows, frontmost first.
+// Window titles are only available with the Screen Recording permission.
+func listWindows() []window {
+	buf := make([]byte, 64<<10)
+	n := C.listWindows((*C.char)(unsafe.Pointer(&buf[0])), C.int(len(buf)))
+
+	var windows []window
+	for _, line := range strings.Split(string(buf[:n]), "\n") {
+		pid, title, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		w := window{Title: title}
+		w.PID, _ = strconv.Atoi(pid)
+		windows = append(windows, w)
+	}
+	return windows
+}
+
+// raiseWindow raises w above the other windows of its application.
+func raiseWindow(w window) bool {
+	title := C.CString(w.Title)
+	defer C.free(unsafe.Pointer(title))
+	return C.raiseWindow(C.int(w.PID), title) != 0
+}